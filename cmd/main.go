@@ -1,15 +1,20 @@
 package main
 
 import (
+	"context"
 	"github.com/joho/godotenv"
 	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
 	_ "github.com/mao360/musicLib/migrations"
 	"github.com/mao360/musicLib/pkg/delivery"
 	"github.com/mao360/musicLib/pkg/postgres"
 	"github.com/mao360/musicLib/pkg/service"
+	"github.com/mao360/musicLib/pkg/songinfo"
 	"github.com/sirupsen/logrus"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // @title Music Lib App API
@@ -31,29 +36,194 @@ func main() {
 	connURL := os.Getenv("CONN_URL")
 	servicePort := os.Getenv("SERVICE_PORT")
 	externalServiceDomain := os.Getenv("EXTERNAL_SERVICE_DOMAIN")
+	searchLanguage := os.Getenv("SEARCH_LANGUAGE")
+	bodyLimit := os.Getenv("BODY_LIMIT")
+	importBodyLimit := os.Getenv("IMPORT_BODY_LIMIT")
 	reloadMigration, err := strconv.ParseBool(os.Getenv("RELOAD_MIGRATION"))
 	if err != nil {
 		logger.Fatal("error parsing RELOAD_MIGRATION")
 	}
+	if searchLanguage == "" {
+		searchLanguage = "russian"
+	}
+	searchConfig, ok := service.SearchConfig(searchLanguage)
+	if !ok {
+		logger.Fatal("error parsing SEARCH_LANGUAGE")
+	}
+	retention := envDuration(logger, "TRASH_RETENTION", "720h")
+	if bodyLimit == "" {
+		bodyLimit = "1M"
+	}
+	if importBodyLimit == "" {
+		importBodyLimit = "100M"
+	}
+	queryDeadline := envDuration(logger, "QUERY_TIMEOUT", "5s")
+	requestDeadline := envDuration(logger, "REQUEST_TIMEOUT", "30s")
+	songInfoConfig := songinfo.Config{
+		Domain:           externalServiceDomain,
+		Timeout:          envDuration(logger, "EXTERNAL_SERVICE_TIMEOUT", "5s"),
+		Retries:          envInt(logger, "EXTERNAL_SERVICE_RETRIES", "2"),
+		Backoff:          envDuration(logger, "EXTERNAL_SERVICE_BACKOFF", "200ms"),
+		BreakerThreshold: envInt(logger, "EXTERNAL_SERVICE_BREAKER_THRESHOLD", "5"),
+		BreakerCooldown:  envDuration(logger, "EXTERNAL_SERVICE_BREAKER_COOLDOWN", "30s"),
+	}
+	enrichmentConfig := service.EnrichmentConfig{
+		Workers:      envInt(logger, "ENRICHMENT_WORKERS", "4"),
+		MaxAttempts:  envInt(logger, "ENRICHMENT_MAX_ATTEMPTS", "5"),
+		Backoff:      envDuration(logger, "ENRICHMENT_BACKOFF", "30s"),
+		MaxBackoff:   envDuration(logger, "ENRICHMENT_MAX_BACKOFF", "1h"),
+		Lease:        envDuration(logger, "ENRICHMENT_LEASE", "1m"),
+		PollInterval: time.Second,
+	}
+	asyncEnrichment := false
+	if value := os.Getenv("ASYNC_ENRICHMENT"); value != "" {
+		asyncEnrichment, err = strconv.ParseBool(value)
+		if err != nil {
+			logger.Fatal("error parsing ASYNC_ENRICHMENT")
+		}
+	}
+	songInfoCacheConfig := songinfo.CacheConfig{
+		Size:        envInt(logger, "SONG_INFO_CACHE_SIZE", "10000"),
+		TTL:         envDuration(logger, "SONG_INFO_CACHE_TTL", "24h"),
+		NegativeTTL: envDuration(logger, "SONG_INFO_CACHE_NEGATIVE_TTL", "1h"),
+	}
+	persistentCache := false
+	if value := os.Getenv("SONG_INFO_CACHE_PERSISTENT"); value != "" {
+		persistentCache, err = strconv.ParseBool(value)
+		if err != nil {
+			logger.Fatal("error parsing SONG_INFO_CACHE_PERSISTENT")
+		}
+	}
 
 	conn, err := postgres.ConnectToDB(connURL, reloadMigration, logger)
 	defer conn.Close()
 	if err != nil {
 		logger.Fatalf("can`t connect to database: %v", err)
 	}
-	db := postgres.NewDB(conn, logger)
-	s := service.NewService(db, logger)
-	h := delivery.NewHandler(s, logger, externalServiceDomain)
+	db := postgres.NewDB(conn, logger, queryDeadline)
+	var cacheStore songinfo.Store
+	if persistentCache {
+		cacheStore = db
+	}
+	songInfoCache := songinfo.NewCache(songInfoCacheConfig, cacheStore, logger)
+	songInfo := songinfo.NewChain(logger, enrichmentProviders(logger, songInfoConfig, songInfoCache)...)
+	s := service.NewService(db, logger, searchConfig, retention, songInfo, enrichmentConfig)
+	go s.PurgeTrashEvery(context.Background(), time.Hour)
+	go songInfoCache.PurgeEvery(context.Background(), time.Hour)
+	go s.RunEnrichment(context.Background())
+	h := delivery.NewHandler(s, logger, songInfo, songInfoCache, asyncEnrichment)
 	e := echo.New()
+	e.HTTPErrorHandler = h.HandleError
+	e.Use(middleware.RequestID())
+	// Imports carry whole catalogues, they get a limit of their own.
+	e.Use(middleware.BodyLimitWithConfig(middleware.BodyLimitConfig{
+		Skipper: func(c echo.Context) bool {
+			return c.Path() == "/songs/import"
+		},
+		Limit: bodyLimit,
+	}))
+	// Imports and exports stream for as long as the catalogue takes, they are
+	// only bounded by the query timeout and by the client going away.
+	if requestDeadline > 0 {
+		e.Use(middleware.ContextTimeoutWithConfig(middleware.ContextTimeoutConfig{
+			Skipper: func(c echo.Context) bool {
+				return c.Path() == "/songs/import" || c.Path() == "/songs/export"
+			},
+			Timeout: requestDeadline,
+		}))
+	}
 
-	e.GET("/songs", h.GetSongsByFilter)
-	e.GET("/song/:id", h.GetText)
+	e.GET("/songs", h.GetSongsByFilter, delivery.CacheControl("no-cache"))
+	e.GET("/songs/search", h.SearchSongs)
+	e.POST("/songs/import", h.ImportSongs, middleware.BodyLimit(importBodyLimit))
+	e.GET("/songs/export", h.ExportSongs)
+	e.GET("/song/:id", h.GetText, delivery.CacheControl("private, max-age=10"))
 	e.DELETE("/song/:id", h.DeleteSong)
 	e.PUT("/song/:id", h.ChangeSong)
+	e.PATCH("/song/:id", h.PatchSong)
 	e.POST("/song", h.AddSong)
+	e.GET("/song/:id/revisions", h.GetSongRevisions)
+	e.GET("/song/:id/revisions/diff", h.DiffSongRevisions)
+	e.POST("/song/:id/revisions/:revision/revert", h.RevertSong)
+
+	e.GET("/artists", h.GetArtists)
+	e.GET("/artist/:id", h.GetArtist)
+	e.POST("/artist", h.AddArtist)
+	e.PUT("/artist/:id", h.RenameArtist)
+	e.DELETE("/artist/:id", h.DeleteArtist)
+
+	e.GET("/album/:id", h.GetAlbum)
+	e.POST("/album", h.AddAlbum)
+	e.GET("/album/:id/tracks", h.GetAlbumTracks)
+	e.POST("/album/:id/tracks", h.AttachTrack)
+	e.PUT("/album/:id/tracks", h.ReorderTracks)
+
+	e.GET("/trash/songs", h.GetTrash)
+	e.POST("/trash/song/:id/restore", h.RestoreSong)
+	e.DELETE("/trash/song/:id", h.PurgeSong)
+
+	e.GET("/admin/enrichment/dead", h.GetDeadEnrichmentJobs)
+	e.POST("/admin/enrichment/job/:id/requeue", h.RequeueEnrichmentJob)
+	e.DELETE("/admin/enrichment/cache", h.InvalidateSongInfoCache)
 
 	err = e.Start(servicePort)
 	if err != nil {
 		logger.Fatalf("failed to sarat server %v", err)
 	}
 }
+
+// envDuration reads a non-negative duration from the environment, fallback
+// if it is not set.
+func envDuration(logger *logrus.Logger, key, fallback string) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		value = fallback
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		logger.Fatalf("error parsing %s", key)
+	}
+	return d
+}
+
+// envInt reads a non-negative integer from the environment, fallback if it
+// is not set.
+func envInt(logger *logrus.Logger, key, fallback string) int {
+	value := os.Getenv(key)
+	if value == "" {
+		value = fallback
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		logger.Fatalf("error parsing %s", key)
+	}
+	return n
+}
+
+// enrichmentProviders builds the providers named in ENRICHMENT_PROVIDERS, in
+// their order of precedence. The answers of the song info service go through
+// cache.
+func enrichmentProviders(logger *logrus.Logger, songInfoConfig songinfo.Config, cache *songinfo.Cache) []songinfo.EnrichmentProvider {
+	names := os.Getenv("ENRICHMENT_PROVIDERS")
+	if names == "" {
+		names = songinfo.ProviderAPI
+	}
+	providers := make([]songinfo.EnrichmentProvider, 0)
+	for _, name := range strings.Split(names, ",") {
+		switch strings.TrimSpace(name) {
+		case songinfo.ProviderAPI:
+			providers = append(providers, cache.Wrap(songinfo.NewClient(songInfoConfig, logger)))
+		case songinfo.ProviderFile:
+			file, err := songinfo.NewFile(os.Getenv("METADATA_FILE"))
+			if err != nil {
+				logger.Fatalf("error loading METADATA_FILE: %v", err)
+			}
+			providers = append(providers, file)
+		case songinfo.ProviderNoop:
+			providers = append(providers, songinfo.Noop{})
+		default:
+			logger.Fatalf("error parsing ENRICHMENT_PROVIDERS: unknown provider %s", name)
+		}
+	}
+	return providers
+}
@@ -0,0 +1,33 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigrationContext(UpSongTimestamps, DownSongTimestamps)
+}
+
+func UpSongTimestamps(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx,
+		`ALTER TABLE songs
+	ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+	ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now();`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func DownSongTimestamps(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx,
+		`ALTER TABLE songs
+	DROP COLUMN IF EXISTS created_at,
+	DROP COLUMN IF EXISTS updated_at;`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,49 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigrationContext(UpArtists, DownArtists)
+}
+
+func UpArtists(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx,
+		`CREATE TABLE artists (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	);
+	INSERT INTO artists (name)
+	SELECT DISTINCT COALESCE(group_name, '') FROM songs;
+	ALTER TABLE songs ADD COLUMN artist_id INT REFERENCES artists (id) ON DELETE RESTRICT;
+	UPDATE songs SET artist_id = artists.id
+	FROM artists
+	WHERE artists.name = COALESCE(songs.group_name, '');
+	ALTER TABLE songs ALTER COLUMN artist_id SET NOT NULL;
+	ALTER TABLE songs DROP COLUMN group_name;
+	CREATE INDEX idx_artist_id ON songs (artist_id);`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func DownArtists(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx,
+		`ALTER TABLE songs ADD COLUMN group_name VARCHAR(255);
+	UPDATE songs SET group_name = artists.name
+	FROM artists
+	WHERE artists.id = songs.artist_id;
+	CREATE INDEX idx_group_name ON songs (group_name);
+	ALTER TABLE songs DROP COLUMN IF EXISTS artist_id;
+	DROP TABLE IF EXISTS artists;`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
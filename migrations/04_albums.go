@@ -0,0 +1,47 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigrationContext(UpAlbums, DownAlbums)
+}
+
+func UpAlbums(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx,
+		`CREATE TABLE albums (
+    id SERIAL PRIMARY KEY,
+    artist_id INT NOT NULL REFERENCES artists (id) ON DELETE RESTRICT,
+    title VARCHAR(255) NOT NULL,
+    release_date VARCHAR(10) NOT NULL DEFAULT '',
+    cover_link VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    UNIQUE (artist_id, title)
+	);
+	CREATE TABLE album_tracks (
+    album_id INT NOT NULL REFERENCES albums (id) ON DELETE CASCADE,
+    song_id INT NOT NULL REFERENCES songs (id) ON DELETE CASCADE,
+    position INT NOT NULL CHECK (position > 0),
+    PRIMARY KEY (album_id, song_id),
+    UNIQUE (album_id, position) DEFERRABLE INITIALLY DEFERRED
+	);
+	CREATE INDEX idx_album_tracks_song_id ON album_tracks (song_id);`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func DownAlbums(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx,
+		`DROP TABLE IF EXISTS album_tracks;
+	DROP TABLE IF EXISTS albums;`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigrationContext(UpSongSearch, DownSongSearch)
+}
+
+// UpSongSearch indexes lyrics with both russian and english configurations,
+// so a query parsed with either of them finds its lexemes in the vector.
+func UpSongSearch(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx,
+		`DROP INDEX IF EXISTS idx_song_text;
+	ALTER TABLE songs ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (
+	    setweight(to_tsvector('russian', coalesce(song_name, '')), 'A') ||
+	    setweight(to_tsvector('english', coalesce(song_name, '')), 'A') ||
+	    setweight(to_tsvector('russian', coalesce(song_text, '')), 'B') ||
+	    setweight(to_tsvector('english', coalesce(song_text, '')), 'B')
+	) STORED;
+	CREATE INDEX idx_search_vector ON songs USING GIN (search_vector);`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func DownSongSearch(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx,
+		`ALTER TABLE songs DROP COLUMN IF EXISTS search_vector;
+	CREATE INDEX idx_song_text ON songs (song_text);`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
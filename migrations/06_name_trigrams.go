@@ -0,0 +1,32 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigrationContext(UpNameTrigrams, DownNameTrigrams)
+}
+
+func UpNameTrigrams(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx,
+		`CREATE EXTENSION IF NOT EXISTS pg_trgm;
+	CREATE INDEX idx_artist_name_trgm ON artists USING GIN (name gin_trgm_ops);
+	CREATE INDEX idx_song_name_trgm ON songs USING GIN (song_name gin_trgm_ops);`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func DownNameTrigrams(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx,
+		`DROP INDEX IF EXISTS idx_song_name_trgm;
+	DROP INDEX IF EXISTS idx_artist_name_trgm;`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigrationContext(UpReleaseDateType, DownReleaseDateType)
+}
+
+// UpReleaseDateType converts songs.release_date and albums.release_date from
+// dd.mm.yyyy strings to DATE. Non-empty values that can't be parsed become
+// NULL and are listed in the release_date_failures table.
+func UpReleaseDateType(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx,
+		`CREATE FUNCTION pg_temp.parse_release_date(raw TEXT) RETURNS DATE AS $$
+	DECLARE
+	    parsed DATE;
+	BEGIN
+	    IF raw !~ '^\d{2}\.\d{2}\.\d{4}$' THEN
+	        RETURN NULL;
+	    END IF;
+	    parsed := to_date(raw, 'DD.MM.YYYY');
+	    IF to_char(parsed, 'DD.MM.YYYY') <> raw THEN
+	        RETURN NULL;
+	    END IF;
+	    RETURN parsed;
+	EXCEPTION WHEN OTHERS THEN
+	    RETURN NULL;
+	END;
+	$$ LANGUAGE plpgsql IMMUTABLE;
+	CREATE TABLE release_date_failures (
+    table_name VARCHAR(32) NOT NULL,
+    row_id INT NOT NULL,
+    raw_value VARCHAR(10),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (table_name, row_id)
+	);
+
+	ALTER TABLE songs ADD COLUMN release_date_parsed DATE;
+	UPDATE songs SET release_date_parsed=pg_temp.parse_release_date(release_date)
+	WHERE COALESCE(release_date, '') <> '';
+	INSERT INTO release_date_failures (table_name, row_id, raw_value)
+	SELECT 'songs', id, release_date FROM songs
+	WHERE COALESCE(release_date, '') <> '' AND release_date_parsed IS NULL;
+	ALTER TABLE songs DROP COLUMN release_date;
+	ALTER TABLE songs RENAME COLUMN release_date_parsed TO release_date;
+	CREATE INDEX idx_release_date ON songs (release_date);
+
+	ALTER TABLE albums ADD COLUMN release_date_parsed DATE;
+	UPDATE albums SET release_date_parsed=pg_temp.parse_release_date(release_date)
+	WHERE release_date <> '';
+	INSERT INTO release_date_failures (table_name, row_id, raw_value)
+	SELECT 'albums', id, release_date FROM albums
+	WHERE release_date <> '' AND release_date_parsed IS NULL;
+	ALTER TABLE albums DROP COLUMN release_date;
+	ALTER TABLE albums RENAME COLUMN release_date_parsed TO release_date;
+
+	DROP FUNCTION pg_temp.parse_release_date(TEXT);`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// DownReleaseDateType formats the dates back, rows listed in
+// release_date_failures get their original value.
+func DownReleaseDateType(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx,
+		`ALTER TABLE songs ADD COLUMN release_date_raw VARCHAR(10);
+	UPDATE songs SET release_date_raw=to_char(release_date, 'DD.MM.YYYY');
+	UPDATE songs SET release_date_raw=f.raw_value
+	FROM release_date_failures f
+	WHERE f.table_name = 'songs' AND f.row_id = songs.id;
+	ALTER TABLE songs DROP COLUMN release_date;
+	ALTER TABLE songs RENAME COLUMN release_date_raw TO release_date;
+	CREATE INDEX idx_release_date ON songs (release_date);
+
+	ALTER TABLE albums ADD COLUMN release_date_raw VARCHAR(10) NOT NULL DEFAULT '';
+	UPDATE albums SET release_date_raw=COALESCE(to_char(release_date, 'DD.MM.YYYY'), '');
+	UPDATE albums SET release_date_raw=COALESCE(f.raw_value, '')
+	FROM release_date_failures f
+	WHERE f.table_name = 'albums' AND f.row_id = albums.id;
+	ALTER TABLE albums DROP COLUMN release_date;
+	ALTER TABLE albums RENAME COLUMN release_date_raw TO release_date;
+
+	DROP TABLE IF EXISTS release_date_failures;`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigrationContext(UpSongTrash, DownSongTrash)
+}
+
+func UpSongTrash(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx,
+		`ALTER TABLE songs
+	ADD COLUMN deleted_at TIMESTAMPTZ;
+	CREATE INDEX idx_songs_deleted_at ON songs (deleted_at) WHERE deleted_at IS NOT NULL;`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// DownSongTrash purges the trash, the songs in it would come back otherwise.
+func DownSongTrash(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx,
+		`DELETE FROM songs WHERE deleted_at IS NOT NULL;
+	DROP INDEX IF EXISTS idx_songs_deleted_at;
+	ALTER TABLE songs
+	DROP COLUMN IF EXISTS deleted_at;`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,55 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigrationContext(UpSongRevisions, DownSongRevisions)
+}
+
+// UpSongRevisions creates the revision history of songs, starting it with
+// the current state of every song. Revisions are never changed, only removed
+// together with their song.
+func UpSongRevisions(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx,
+		`CREATE TABLE song_revisions (
+    song_id INT NOT NULL REFERENCES songs (id) ON DELETE CASCADE,
+    revision INT NOT NULL CHECK (revision > 0),
+    artist_name VARCHAR(255) NOT NULL,
+    song_name VARCHAR(255),
+    song_text TEXT,
+    release_date DATE,
+    link VARCHAR(255),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (song_id, revision)
+	);
+	CREATE FUNCTION song_revisions_append_only() RETURNS trigger AS $$
+	BEGIN
+	    RAISE EXCEPTION 'song revisions can not be changed';
+	END;
+	$$ LANGUAGE plpgsql;
+	CREATE TRIGGER song_revisions_no_update
+	BEFORE UPDATE ON song_revisions
+	FOR EACH ROW EXECUTE FUNCTION song_revisions_append_only();
+	INSERT INTO song_revisions (song_id, revision, artist_name, song_name, song_text, release_date, link, created_at)
+	SELECT s.id, 1, a.name, s.song_name, s.song_text, s.release_date, s.link, s.updated_at
+	FROM songs s
+	JOIN artists a ON a.id = s.artist_id;`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func DownSongRevisions(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx,
+		`DROP TABLE IF EXISTS song_revisions;
+	DROP FUNCTION IF EXISTS song_revisions_append_only();`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
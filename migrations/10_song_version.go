@@ -0,0 +1,31 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigrationContext(UpSongVersion, DownSongVersion)
+}
+
+func UpSongVersion(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx,
+		`ALTER TABLE songs
+	ADD COLUMN version INT NOT NULL DEFAULT 1;`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func DownSongVersion(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx,
+		`ALTER TABLE songs
+	DROP COLUMN IF EXISTS version;`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigrationContext(UpSongEnrichment, DownSongEnrichment)
+}
+
+// UpSongEnrichment adds the enrichment status of songs and the queue of the
+// songs waiting for their details from the song info service. Jobs with
+// dead_at set failed for good and are kept until retried by hand.
+func UpSongEnrichment(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx,
+		`ALTER TABLE songs
+	ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT 'ready'
+	    CHECK (status IN ('ready', 'pending', 'failed'));
+	CREATE TABLE enrichment_jobs (
+    id SERIAL PRIMARY KEY,
+    song_id INT NOT NULL UNIQUE REFERENCES songs (id) ON DELETE CASCADE,
+    attempts INT NOT NULL DEFAULT 0,
+    run_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    locked_until TIMESTAMPTZ,
+    last_error TEXT NOT NULL DEFAULT '',
+    dead_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	);
+	CREATE INDEX enrichment_jobs_run_at_idx ON enrichment_jobs (run_at) WHERE dead_at IS NULL;`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func DownSongEnrichment(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx,
+		`DROP TABLE IF EXISTS enrichment_jobs;
+	ALTER TABLE songs
+	DROP COLUMN IF EXISTS status;`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"github.com/pressly/goose/v3"
+)
+
+func init() {
+	goose.AddMigrationContext(UpSongInfoCache, DownSongInfoCache)
+}
+
+// UpSongInfoCache creates the persistent tier of the song info cache. A
+// rejected entry remembers that the service refused the song.
+func UpSongInfoCache(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx,
+		`CREATE TABLE song_info_cache (
+    cache_key TEXT PRIMARY KEY,
+    info JSONB NOT NULL,
+    rejected BOOLEAN NOT NULL DEFAULT false,
+    expires_at TIMESTAMPTZ NOT NULL
+	);
+	CREATE INDEX idx_song_info_cache_expires_at ON song_info_cache (expires_at);`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func DownSongInfoCache(ctx context.Context, tx *sql.Tx) error {
+	_, err := tx.ExecContext(ctx,
+		`DROP TABLE IF EXISTS song_info_cache;`)
+	if err != nil {
+		return err
+	}
+	return nil
+}
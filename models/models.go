@@ -1,9 +1,184 @@
 package models
 
+import "time"
+
 type Song struct {
-	Group       string `json:"group"`
-	Song        string `json:"song"`
-	Text        string `json:"text"`
-	ReleaseDate string `json:"releaseDate"`
-	Link        string `json:"link"`
+	ID          int       `json:"id"`
+	ArtistID    int       `json:"artistId"`
+	Group       string    `json:"group"`
+	Song        string    `json:"song"`
+	Text        string    `json:"text"`
+	ReleaseDate string    `json:"releaseDate"`
+	Link        string    `json:"link"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+	Version     int       `json:"version"`
+	// Status is pending while the song waits for its details from the song
+	// info service and failed if they could not be fetched.
+	Status string `json:"status"`
+}
+
+type SongText struct {
+	ID        int       `json:"id"`
+	Text      string    `json:"text"`
+	Version   int       `json:"version"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type Artist struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type Album struct {
+	ID          int       `json:"id"`
+	ArtistID    int       `json:"artistId"`
+	Artist      string    `json:"artist"`
+	Title       string    `json:"title"`
+	ReleaseDate string    `json:"releaseDate"`
+	CoverLink   string    `json:"coverLink"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+type Track struct {
+	Position int  `json:"position"`
+	Song     Song `json:"song"`
+}
+
+type TrackAttach struct {
+	SongID   int `json:"songId"`
+	Position int `json:"position"`
+}
+
+type TrackOrder struct {
+	SongIDs []int `json:"songIds"`
+}
+
+type SearchResult struct {
+	Song    Song    `json:"song"`
+	Rank    float32 `json:"rank"`
+	Snippet string  `json:"snippet"`
+}
+
+type SortField struct {
+	Field string `json:"field"`
+	Desc  bool   `json:"desc,omitempty"`
+}
+
+// Cursor holds the sort key values of the song a keyset page starts after
+// (or, when Backward, ends before). Sort is the sort parameter the cursor was
+// issued for.
+type Cursor struct {
+	Keys     []string `json:"keys"`
+	Sort     string   `json:"sort,omitempty"`
+	Backward bool     `json:"backward,omitempty"`
+}
+
+// Page is the envelope of list responses. Next and Prev are links to the
+// neighbouring pages, NextCursor and PrevCursor are the keyset cursors they
+// are built from.
+type Page struct {
+	Items      interface{} `json:"items"`
+	Total      int         `json:"total"`
+	Page       int         `json:"page,omitempty"`
+	PageSize   int         `json:"pageSize"`
+	Next       string      `json:"next,omitempty"`
+	Prev       string      `json:"prev,omitempty"`
+	NextCursor string      `json:"-"`
+	PrevCursor string      `json:"-"`
+}
+
+type ImportRow struct {
+	Row    int    `json:"row"`
+	Status string `json:"status"`
+	ID     int    `json:"id,omitempty"`
+	Error  string `json:"error,omitempty"`
+}
+
+type ImportReport struct {
+	Created int         `json:"created"`
+	Skipped int         `json:"skipped"`
+	Invalid int         `json:"invalid"`
+	Rows    []ImportRow `json:"rows"`
+}
+
+type TrashedSong struct {
+	Song
+	DeletedAt time.Time  `json:"deletedAt"`
+	PurgeAt   *time.Time `json:"purgeAt,omitempty"`
+}
+
+// EnrichmentJob is a song queued for its details from the song info
+// service. A job with DeadAt set failed for good.
+type EnrichmentJob struct {
+	ID        int        `json:"id"`
+	SongID    int        `json:"songId"`
+	Group     string     `json:"group"`
+	Song      string     `json:"song"`
+	Attempts  int        `json:"attempts"`
+	LastError string     `json:"lastError"`
+	RunAt     time.Time  `json:"runAt"`
+	DeadAt    *time.Time `json:"deadAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+}
+
+// SongInfoCacheEntry is a cached answer of the song info service, Rejected
+// if the service refused the song.
+type SongInfoCacheEntry struct {
+	Key       string    `json:"key"`
+	Info      Song      `json:"info"`
+	Rejected  bool      `json:"rejected"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+type SongRevision struct {
+	SongID      int       `json:"songId"`
+	Revision    int       `json:"revision"`
+	Group       string    `json:"group"`
+	Song        string    `json:"song"`
+	Text        string    `json:"text"`
+	ReleaseDate string    `json:"releaseDate"`
+	Link        string    `json:"link"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+type LineChange struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+type FieldChange struct {
+	Field string       `json:"field"`
+	From  string       `json:"from"`
+	To    string       `json:"to"`
+	Lines []LineChange `json:"lines,omitempty"`
+}
+
+type SongDiff struct {
+	SongID  int           `json:"songId"`
+	From    int           `json:"from"`
+	To      int           `json:"to"`
+	Changes []FieldChange `json:"changes"`
+}
+
+// Problem is an RFC 7807 problem details error body.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance"`
+	RequestID string       `json:"requestId,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+	// Report is the partial report of an import that failed halfway.
+	Report *ImportReport `json:"report,omitempty"`
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
 }
@@ -0,0 +1,133 @@
+// Package apperrors is the error taxonomy shared by the layers. The
+// repository and the service return *Error values of a Kind, the delivery
+// layer maps the kind to an HTTP status.
+package apperrors
+
+import (
+	"errors"
+	"strings"
+)
+
+type Kind int
+
+const (
+	Internal Kind = iota
+	NotFound
+	Conflict
+	Validation
+	Upstream
+	// Precondition is a change based on a stale version of a resource.
+	Precondition
+	// Unavailable is a dependency refusing calls for a while.
+	Unavailable
+	// Timeout is a dependency that did not answer in time.
+	Timeout
+)
+
+var kindNames = map[Kind]string{
+	Internal:     "internal",
+	NotFound:     "not found",
+	Conflict:     "conflict",
+	Validation:   "validation",
+	Upstream:     "upstream",
+	Precondition: "precondition failed",
+	Unavailable:  "unavailable",
+	Timeout:      "timeout",
+}
+
+func (k Kind) String() string {
+	return kindNames[k]
+}
+
+// Kind sentinels, errors.Is(err, apperrors.ErrNotFound) is true for every
+// not found error however deep it is wrapped.
+var (
+	ErrNotFound     = &Error{Kind: NotFound}
+	ErrConflict     = &Error{Kind: Conflict}
+	ErrValidation   = &Error{Kind: Validation}
+	ErrUpstream     = &Error{Kind: Upstream}
+	ErrPrecondition = &Error{Kind: Precondition}
+	ErrUnavailable  = &Error{Kind: Unavailable}
+	ErrTimeout      = &Error{Kind: Timeout}
+)
+
+type Error struct {
+	Kind    Kind
+	Message string
+	Err     error
+	// Fields lists the invalid input fields of a Validation error.
+	Fields []FieldError
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func New(kind Kind, message string) *Error {
+	return &Error{Kind: kind, Message: message}
+}
+
+// Field is a Validation error of a single input field.
+func Field(field, message string) *Error {
+	return &Error{Kind: Validation, Message: message, Fields: []FieldError{{field, message}}}
+}
+
+// Invalid is a Validation error listing every invalid field at once.
+func Invalid(fields ...FieldError) *Error {
+	messages := make([]string, 0, len(fields))
+	for _, field := range fields {
+		messages = append(messages, field.Field+": "+field.Message)
+	}
+	return &Error{Kind: Validation, Message: strings.Join(messages, "; "), Fields: fields}
+}
+
+// FieldsOf collects the invalid fields of every *Error in err's chain.
+func FieldsOf(err error) []FieldError {
+	var fields []FieldError
+	for err != nil {
+		var e *Error
+		if !errors.As(err, &e) {
+			break
+		}
+		fields = append(fields, e.Fields...)
+		err = e.Err
+	}
+	return fields
+}
+
+// Wrap gives err a kind and a message, err stays reachable by errors.Is and
+// errors.As.
+func Wrap(kind Kind, message string, err error) *Error {
+	return &Error{Kind: kind, Message: message, Err: err}
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Message
+	}
+	if e.Message == "" {
+		return e.Err.Error()
+	}
+	return e.Message + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the kind sentinels, other errors only match themselves.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Message == "" && t.Err == nil && t.Fields == nil && t.Kind == e.Kind
+}
+
+// KindOf is the kind of the outermost *Error in err's chain, Internal if
+// there is none.
+func KindOf(err error) Kind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return Internal
+}
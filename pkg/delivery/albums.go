@@ -0,0 +1,188 @@
+package delivery
+
+import (
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"github.com/mao360/musicLib/models"
+	"github.com/sirupsen/logrus"
+)
+
+// @Summary Get album
+// @Description Get album by id
+// @Produce json
+// @Param id path string true "ID"
+// @Success 200 {object} models.Album
+// @Failure 400 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Router /album/{id} [get]
+func (h *Handler) GetAlbum(c echo.Context) error {
+	h.logger.WithFields(logrus.Fields{
+		"handler": "GetAlbum",
+	}).Infof("started")
+	albumID := c.Param("id")
+	h.logger.Debugf("albumID=%s", albumID)
+	album, err := h.service.GetAlbumByID(c.Request().Context(), albumID)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"layer":    "delivery",
+			"handler":  "GetAlbum",
+			"function": "service.GetAlbumByID",
+		}).Errorf("err: %v", err)
+		return err
+	}
+	h.logger.WithFields(logrus.Fields{
+		"handler": "GetAlbum",
+	}).Infof("finished")
+	return c.JSON(200, album)
+}
+
+// @Summary Add Album
+// @Description Add album of an existing artist to db
+// @Accept json
+// @Produce json
+// @Param requestBody body models.Album true "JSON payload for creating a resource"
+// @Success 201 {object} models.Album
+// @Header 201 {string} Location "URL of the created album"
+// @Failure 400 {object} models.Problem
+// @Failure 409 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Router /album [post]
+func (h *Handler) AddAlbum(c echo.Context) error {
+	h.logger.WithFields(logrus.Fields{
+		"handler": "AddAlbum",
+	}).Infof("started")
+	album := models.Album{}
+	if err := c.Bind(&album); err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"layer":    "delivery",
+			"handler":  "AddAlbum",
+			"function": "c.Bind",
+		}).Errorf("err: %v", err)
+		return err
+	}
+	h.logger.Debugf("artistID=%d title=%s", album.ArtistID, album.Title)
+	created, err := h.service.AddAlbum(c.Request().Context(), album)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"layer":    "delivery",
+			"handler":  "AddAlbum",
+			"function": "service.AddAlbum",
+		}).Errorf("err: %v", err)
+		return err
+	}
+	h.logger.WithFields(logrus.Fields{
+		"handler": "AddAlbum",
+	}).Infof("finished")
+	c.Response().Header().Set(echo.HeaderLocation, fmt.Sprintf("/album/%d", created.ID))
+	return c.JSON(201, created)
+}
+
+// @Summary Get album tracks
+// @Description Get album track listing ordered by position
+// @Produce json
+// @Param id path string true "ID"
+// @Success 200 {object} []models.Track
+// @Failure 400 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Router /album/{id}/tracks [get]
+func (h *Handler) GetAlbumTracks(c echo.Context) error {
+	h.logger.WithFields(logrus.Fields{
+		"handler": "GetAlbumTracks",
+	}).Infof("started")
+	albumID := c.Param("id")
+	h.logger.Debugf("albumID=%s", albumID)
+	tracks, err := h.service.GetAlbumTracks(c.Request().Context(), albumID)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"layer":    "delivery",
+			"handler":  "GetAlbumTracks",
+			"function": "service.GetAlbumTracks",
+		}).Errorf("err: %v", err)
+		return err
+	}
+	h.logger.WithFields(logrus.Fields{
+		"handler": "GetAlbumTracks",
+	}).Infof("finished")
+	return c.JSON(200, tracks)
+}
+
+// @Summary Attach track
+// @Description Put song on the album at position, following tracks are shifted down. Without position the song is appended
+// @Accept json
+// @Param requestBody body models.TrackAttach true "JSON payload with song id and optional position"
+// @Param id path string true "ID"
+// @Success 200 {object} string
+// @Failure 400 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 409 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Router /album/{id}/tracks [post]
+func (h *Handler) AttachTrack(c echo.Context) error {
+	h.logger.WithFields(logrus.Fields{
+		"handler": "AttachTrack",
+	}).Infof("started")
+	track := models.TrackAttach{}
+	if err := c.Bind(&track); err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"layer":    "delivery",
+			"handler":  "AttachTrack",
+			"function": "c.Bind",
+		}).Errorf("err: %v", err)
+		return err
+	}
+	albumID := c.Param("id")
+	h.logger.Debugf("albumID=%s songID=%d position=%d", albumID, track.SongID, track.Position)
+	if err := h.service.AttachTrack(c.Request().Context(), albumID, track); err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"layer":    "delivery",
+			"handler":  "AttachTrack",
+			"function": "service.AttachTrack",
+		}).Errorf("err: %v", err)
+		return err
+	}
+	h.logger.WithFields(logrus.Fields{
+		"handler": "AttachTrack",
+	}).Infof("finished")
+	return c.String(200, "ok")
+}
+
+// @Summary Reorder tracks
+// @Description Set new order of album tracks, the list must contain every song of the album exactly once
+// @Accept json
+// @Param requestBody body models.TrackOrder true "JSON payload with song ids in the new order"
+// @Param id path string true "ID"
+// @Success 200 {object} string
+// @Failure 400 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Router /album/{id}/tracks [put]
+func (h *Handler) ReorderTracks(c echo.Context) error {
+	h.logger.WithFields(logrus.Fields{
+		"handler": "ReorderTracks",
+	}).Infof("started")
+	order := models.TrackOrder{}
+	if err := c.Bind(&order); err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"layer":    "delivery",
+			"handler":  "ReorderTracks",
+			"function": "c.Bind",
+		}).Errorf("err: %v", err)
+		return err
+	}
+	albumID := c.Param("id")
+	h.logger.Debugf("albumID=%s songIDs=%v", albumID, order.SongIDs)
+	if err := h.service.ReorderTracks(c.Request().Context(), albumID, order); err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"layer":    "delivery",
+			"handler":  "ReorderTracks",
+			"function": "service.ReorderTracks",
+		}).Errorf("err: %v", err)
+		return err
+	}
+	h.logger.WithFields(logrus.Fields{
+		"handler": "ReorderTracks",
+	}).Infof("finished")
+	return c.String(200, "ok")
+}
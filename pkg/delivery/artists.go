@@ -0,0 +1,187 @@
+package delivery
+
+import (
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"github.com/mao360/musicLib/models"
+	"github.com/sirupsen/logrus"
+)
+
+// @Summary Get all artists
+// @Description Get all artists with pagination
+// @Produce json
+// @Param page query string true "The page query parameter (required)"
+// @Param pageSize query string true "The pageSize query parameter (required)"
+// @Success 200 {object} models.Page{items=[]models.Artist}
+// @Header 200 {string} Link "Links to the next and previous pages"
+// @Failure 400 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Router /artists [get]
+func (h *Handler) GetArtists(c echo.Context) error {
+	h.logger.WithFields(logrus.Fields{
+		"handler": "GetArtists",
+	}).Infof("started")
+
+	pageNum := c.QueryParam("page")
+	pageSize := c.QueryParam("pageSize")
+
+	h.logger.Debugf("pageSize=%s, pageNum=%s", pageSize, pageNum)
+	page, err := h.service.GetArtists(c.Request().Context(), pageSize, pageNum)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"layer":    "delivery",
+			"handler":  "GetArtists",
+			"function": "service.GetArtists",
+		}).Errorf("err: %v", err)
+		return err
+	}
+	setPageLinks(c, &page)
+	h.logger.WithFields(logrus.Fields{
+		"handler": "GetArtists",
+	}).Infof("finished")
+	return c.JSON(200, page)
+}
+
+// @Summary Get artist
+// @Description Get artist by id
+// @Produce json
+// @Param id path string true "ID"
+// @Success 200 {object} models.Artist
+// @Failure 400 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Router /artist/{id} [get]
+func (h *Handler) GetArtist(c echo.Context) error {
+	h.logger.WithFields(logrus.Fields{
+		"handler": "GetArtist",
+	}).Infof("started")
+	artistID := c.Param("id")
+	h.logger.Debugf("artistID=%s", artistID)
+	artist, err := h.service.GetArtistByID(c.Request().Context(), artistID)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"layer":    "delivery",
+			"handler":  "GetArtist",
+			"function": "service.GetArtistByID",
+		}).Errorf("err: %v", err)
+		return err
+	}
+	h.logger.WithFields(logrus.Fields{
+		"handler": "GetArtist",
+	}).Infof("finished")
+	return c.JSON(200, artist)
+}
+
+// @Summary Add Artist
+// @Description Add artist to db
+// @Accept json
+// @Produce json
+// @Param requestBody body models.Artist true "JSON payload for creating a resource"
+// @Success 201 {object} models.Artist
+// @Header 201 {string} Location "URL of the created artist"
+// @Failure 400 {object} models.Problem
+// @Failure 409 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Router /artist [post]
+func (h *Handler) AddArtist(c echo.Context) error {
+	h.logger.WithFields(logrus.Fields{
+		"handler": "AddArtist",
+	}).Infof("started")
+	artist := models.Artist{}
+	if err := c.Bind(&artist); err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"layer":    "delivery",
+			"handler":  "AddArtist",
+			"function": "c.Bind",
+		}).Errorf("err: %v", err)
+		return err
+	}
+	h.logger.Debugf("name=%s", artist.Name)
+	created, err := h.service.AddArtist(c.Request().Context(), artist)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"layer":    "delivery",
+			"handler":  "AddArtist",
+			"function": "service.AddArtist",
+		}).Errorf("err: %v", err)
+		return err
+	}
+	h.logger.WithFields(logrus.Fields{
+		"handler": "AddArtist",
+	}).Infof("finished")
+	c.Response().Header().Set(echo.HeaderLocation, fmt.Sprintf("/artist/%d", created.ID))
+	return c.JSON(201, created)
+}
+
+// @Summary Rename Artist
+// @Description Rename artist, songs keep pointing to it
+// @Accept json
+// @Produce json
+// @Param requestBody body models.Artist true "JSON payload with the new name"
+// @Param id path string true "ID"
+// @Success 200 {object} models.Artist
+// @Failure 400 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 409 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Router /artist/{id} [put]
+func (h *Handler) RenameArtist(c echo.Context) error {
+	h.logger.WithFields(logrus.Fields{
+		"handler": "RenameArtist",
+	}).Infof("started")
+	artist := models.Artist{}
+	if err := c.Bind(&artist); err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"layer":    "delivery",
+			"handler":  "RenameArtist",
+			"function": "c.Bind",
+		}).Errorf("err: %v", err)
+		return err
+	}
+	artistID := c.Param("id")
+	h.logger.Debugf("artistID=%s name=%s", artistID, artist.Name)
+	renamed, err := h.service.RenameArtistByID(c.Request().Context(), artistID, artist)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"layer":    "delivery",
+			"handler":  "RenameArtist",
+			"function": "service.RenameArtistByID",
+		}).Errorf("err: %v", err)
+		return err
+	}
+	h.logger.WithFields(logrus.Fields{
+		"handler": "RenameArtist",
+	}).Infof("finished")
+	return c.JSON(200, renamed)
+}
+
+// @Summary Delete Artist
+// @Description Delete artist from db. With policy=restrict (default) artists that still have songs or albums are kept, with policy=cascade their songs and albums are deleted too
+// @Param id path string true "ID"
+// @Param policy query string false "The policy query parameter: restrict or cascade (optional)"
+// @Success 200 {object} string
+// @Failure 400 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 409 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Router /artist/{id} [delete]
+func (h *Handler) DeleteArtist(c echo.Context) error {
+	h.logger.WithFields(logrus.Fields{
+		"handler": "DeleteArtist",
+	}).Infof("started")
+	artistID := c.Param("id")
+	policy := c.QueryParam("policy")
+	h.logger.Debugf("artistID=%s policy=%s", artistID, policy)
+	if err := h.service.DeleteArtistByID(c.Request().Context(), artistID, policy); err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"layer":    "delivery",
+			"handler":  "DeleteArtist",
+			"function": "service.DeleteArtistByID",
+		}).Errorf("err: %v", err)
+		return err
+	}
+	h.logger.WithFields(logrus.Fields{
+		"handler": "DeleteArtist",
+	}).Infof("finished")
+	return c.String(200, "ok")
+}
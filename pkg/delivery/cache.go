@@ -0,0 +1,56 @@
+package delivery
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/labstack/echo/v4"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CacheControl sets the Cache-Control header of a route, e.g.
+// e.GET("/songs", h.GetSongsByFilter, delivery.CacheControl("no-cache")).
+func CacheControl(value string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			c.Response().Header().Set(echo.HeaderCacheControl, value)
+			return next(c)
+		}
+	}
+}
+
+// bodyETag is the strong entity tag of a response body.
+func bodyETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// notModified sets the validators of the response and tells whether the
+// request's If-None-Match or, without it, If-Modified-Since matches them, so
+// that 304 can be sent instead of the body. A zero lastModified is not sent.
+func notModified(c echo.Context, etag string, lastModified time.Time) bool {
+	header := c.Response().Header()
+	header.Set(headerETag, etag)
+	if !lastModified.IsZero() {
+		header.Set(echo.HeaderLastModified, lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if ifNoneMatch := c.Request().Header.Get(headerIfNoneMatch); ifNoneMatch != "" {
+		for _, tag := range strings.Split(ifNoneMatch, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || tag == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+	if lastModified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(c.Request().Header.Get(echo.HeaderIfModifiedSince))
+	if err != nil {
+		return false
+	}
+	return !lastModified.Truncate(time.Second).After(since)
+}
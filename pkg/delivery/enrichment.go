@@ -0,0 +1,134 @@
+package delivery
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/mao360/musicLib/pkg/apperrors"
+	"github.com/sirupsen/logrus"
+	"strings"
+)
+
+var incompleteCacheKey = apperrors.New(apperrors.Validation, "group and song go together, leave both out to clear the cache")
+
+const (
+	headerPrefer            = "Prefer"
+	headerPreferenceApplied = "Preference-Applied"
+	preferRespondAsync      = "respond-async"
+)
+
+// preferAsync reports whether the Prefer header (RFC 7240) asks for an
+// asynchronous answer.
+func preferAsync(c echo.Context) bool {
+	for _, header := range c.Request().Header.Values(headerPrefer) {
+		for _, preference := range strings.Split(header, ",") {
+			token, _, _ := strings.Cut(preference, ";")
+			if strings.EqualFold(strings.TrimSpace(token), preferRespondAsync) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// @Summary Get dead enrichment jobs
+// @Description Get the songs whose details could not be fetched, the latest failed first. lastError is the error of the last attempt
+// @Produce json
+// @Param page query string true "The page query parameter (required)"
+// @Param pageSize query string true "The pageSize query parameter (required)"
+// @Success 200 {object} models.Page{items=[]models.EnrichmentJob}
+// @Header 200 {string} Link "Links to the next and previous pages"
+// @Failure 400 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Router /admin/enrichment/dead [get]
+func (h *Handler) GetDeadEnrichmentJobs(c echo.Context) error {
+	h.logger.WithFields(logrus.Fields{
+		"handler": "GetDeadEnrichmentJobs",
+	}).Infof("started")
+
+	pageNum := c.QueryParam("page")
+	pageSize := c.QueryParam("pageSize")
+
+	h.logger.Debugf("pageSize=%s, pageNum=%s", pageSize, pageNum)
+	page, err := h.service.GetDeadEnrichmentJobs(c.Request().Context(), pageSize, pageNum)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"layer":    "delivery",
+			"handler":  "GetDeadEnrichmentJobs",
+			"function": "service.GetDeadEnrichmentJobs",
+		}).Errorf("err: %v", err)
+		return err
+	}
+	setPageLinks(c, &page)
+	h.logger.WithFields(logrus.Fields{
+		"handler": "GetDeadEnrichmentJobs",
+	}).Infof("finished")
+	return c.JSON(200, page)
+}
+
+// @Summary Requeue enrichment job
+// @Description Put a dead enrichment job back on the queue with its attempts reset, its song is pending again
+// @Produce json
+// @Param id path string true "ID"
+// @Success 200 {object} models.EnrichmentJob
+// @Failure 400 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Router /admin/enrichment/job/{id}/requeue [post]
+func (h *Handler) RequeueEnrichmentJob(c echo.Context) error {
+	h.logger.WithFields(logrus.Fields{
+		"handler": "RequeueEnrichmentJob",
+	}).Infof("started")
+	jobID := c.Param("id")
+	h.logger.Debugf("jobID=%s", jobID)
+	job, err := h.service.RequeueEnrichmentJob(c.Request().Context(), jobID)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"layer":    "delivery",
+			"handler":  "RequeueEnrichmentJob",
+			"function": "service.RequeueEnrichmentJob",
+		}).Errorf("err: %v", err)
+		return err
+	}
+	h.logger.WithFields(logrus.Fields{
+		"handler": "RequeueEnrichmentJob",
+	}).Infof("finished")
+	return c.JSON(200, job)
+}
+
+// @Summary Invalidate song info cache
+// @Description Drop the cached song info answer of a song, matched regardless of case and extra spaces, or the whole cache without group and song
+// @Param group query string false "The group query parameter (optional)"
+// @Param song query string false "The song query parameter (optional)"
+// @Success 200 {object} string
+// @Failure 400 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Router /admin/enrichment/cache [delete]
+func (h *Handler) InvalidateSongInfoCache(c echo.Context) error {
+	h.logger.WithFields(logrus.Fields{
+		"handler": "InvalidateSongInfoCache",
+	}).Infof("started")
+	group := c.QueryParam("group")
+	song := c.QueryParam("song")
+	h.logger.Debugf("group=%s song=%s", group, song)
+
+	var err error
+	switch {
+	case group == "" && song == "":
+		err = h.songInfoCache.Clear(c.Request().Context())
+	case group == "" || song == "":
+		err = incompleteCacheKey
+	default:
+		err = h.songInfoCache.Invalidate(c.Request().Context(), group, song)
+	}
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"layer":    "delivery",
+			"handler":  "InvalidateSongInfoCache",
+			"function": "songInfoCache",
+		}).Errorf("err: %v", err)
+		return err
+	}
+	h.logger.WithFields(logrus.Fields{
+		"handler": "InvalidateSongInfoCache",
+	}).Infof("finished")
+	return c.String(200, "ok")
+}
@@ -0,0 +1,123 @@
+package delivery
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"github.com/mao360/musicLib/models"
+	"github.com/mao360/musicLib/pkg/apperrors"
+	"github.com/sirupsen/logrus"
+	"net/http"
+)
+
+const mimeProblem = "application/problem+json"
+
+// kindStatus is the HTTP status of each apperrors kind, other errors are
+// answered with 500.
+var kindStatus = map[apperrors.Kind]int{
+	apperrors.NotFound:     http.StatusNotFound,
+	apperrors.Conflict:     http.StatusConflict,
+	apperrors.Validation:   http.StatusBadRequest,
+	apperrors.Upstream:     http.StatusBadGateway,
+	apperrors.Precondition: http.StatusPreconditionFailed,
+	apperrors.Unavailable:  http.StatusServiceUnavailable,
+	apperrors.Timeout:      http.StatusGatewayTimeout,
+}
+
+// kindProblemType is the problem type URI of each apperrors kind, errors
+// without a kind are about:blank.
+var kindProblemType = map[apperrors.Kind]string{
+	apperrors.NotFound:     "/problems/not-found",
+	apperrors.Conflict:     "/problems/conflict",
+	apperrors.Validation:   "/problems/validation",
+	apperrors.Upstream:     "/problems/upstream",
+	apperrors.Precondition: "/problems/precondition-failed",
+	apperrors.Unavailable:  "/problems/unavailable",
+	apperrors.Timeout:      "/problems/timeout",
+}
+
+// importError is an import that failed after some of its rows were handled,
+// the problem carries their report.
+type importError struct {
+	err    error
+	report models.ImportReport
+}
+
+func (e *importError) Error() string {
+	return e.err.Error()
+}
+
+func (e *importError) Unwrap() error {
+	return e.err
+}
+
+// newProblem describes err for the client. Only messages meant for clients
+// get into detail: the ones of echo.HTTPError and apperrors.Error, with the
+// wrapped cause only for validation errors. Internal errors get no detail.
+func newProblem(c echo.Context, err error) models.Problem {
+	problem := models.Problem{
+		Type:      "about:blank",
+		Status:    http.StatusInternalServerError,
+		Instance:  c.Request().URL.Path,
+		RequestID: c.Response().Header().Get(echo.HeaderXRequestID),
+	}
+	var httpErr *echo.HTTPError
+	var appErr *apperrors.Error
+	switch {
+	case errors.As(err, &httpErr):
+		problem.Status = httpErr.Code
+		problem.Detail = fmt.Sprint(httpErr.Message)
+	case errors.Is(err, context.DeadlineExceeded):
+		// A query ran out of its timeout outside of the request deadline.
+		problem.Status = http.StatusServiceUnavailable
+		problem.Detail = "request timed out"
+	case errors.As(err, &appErr) && appErr.Kind != apperrors.Internal:
+		problem.Type = kindProblemType[appErr.Kind]
+		problem.Status = kindStatus[appErr.Kind]
+		problem.Detail = appErr.Message
+		if appErr.Kind == apperrors.Validation {
+			problem.Detail = appErr.Error()
+		}
+		for _, field := range apperrors.FieldsOf(err) {
+			problem.Errors = append(problem.Errors, models.FieldError{Field: field.Field, Message: field.Message})
+		}
+	}
+	var importErr *importError
+	if errors.As(err, &importErr) {
+		problem.Report = &importErr.report
+	}
+	problem.Title = http.StatusText(problem.Status)
+	return problem
+}
+
+// HandleError is the echo.HTTPErrorHandler of the API, the handlers return
+// their errors and it answers them with problem details.
+func (h *Handler) HandleError(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+	problem := newProblem(c, err)
+	h.logger.WithFields(logrus.Fields{
+		"layer":     "delivery",
+		"function":  "HandleError",
+		"requestId": problem.RequestID,
+	}).Debugf("status=%d err: %v", problem.Status, err)
+	if c.Request().Method == http.MethodHead {
+		err = c.NoContent(problem.Status)
+	} else {
+		var body []byte
+		body, err = json.Marshal(problem)
+		if err == nil {
+			err = c.Blob(problem.Status, mimeProblem, body)
+		}
+	}
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"layer":       "delivery",
+			"function":    "HandleError",
+			"subFunction": "c.Blob",
+		}).Errorf("err: %v", err)
+	}
+}
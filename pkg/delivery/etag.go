@@ -0,0 +1,84 @@
+package delivery
+
+import (
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"github.com/mao360/musicLib/pkg/apperrors"
+	"strconv"
+	"strings"
+)
+
+const (
+	headerETag        = "ETag"
+	headerIfMatch     = "If-Match"
+	headerIfNoneMatch = "If-None-Match"
+)
+
+var (
+	ifMatchRequired  = echo.NewHTTPError(428, "If-Match header with the song ETag is required")
+	malformedIfMatch = apperrors.Field(headerIfMatch, "If-Match isn't a list of entity tags")
+	severalIfMatch   = apperrors.Field(headerIfMatch, "If-Match holds several song versions")
+	unmatchedIfMatch = apperrors.New(apperrors.Precondition, "If-Match doesn't hold a song ETag")
+)
+
+// songETag is the strong entity tag of a song version.
+func songETag(version int) string {
+	return fmt.Sprintf("%q", strconv.Itoa(version))
+}
+
+// ifMatchVersion reads the song version a change is based on from If-Match.
+// "*" matches any version and gives zero. The header is a list of entity tags
+// compared strongly (RFC 9110 13.1.1): weak tags and tags that aren't song
+// versions can never match, a list left without a song version fails the
+// precondition. A malformed header is a bad request, and so is a list of
+// several song versions, a change is based on one.
+func ifMatchVersion(c echo.Context) (int, error) {
+	ifMatch := strings.TrimSpace(c.Request().Header.Get(headerIfMatch))
+	if ifMatch == "" {
+		return 0, ifMatchRequired
+	}
+	if ifMatch == "*" {
+		return 0, nil
+	}
+	version := 0
+	for _, tag := range strings.Split(ifMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" {
+			continue
+		}
+		weak := strings.HasPrefix(tag, "W/")
+		opaque, ok := opaqueTag(strings.TrimPrefix(tag, "W/"))
+		if !ok {
+			return 0, malformedIfMatch
+		}
+		if weak {
+			continue
+		}
+		tagVersion, err := strconv.Atoi(opaque)
+		if err != nil || tagVersion <= 0 || tagVersion == version {
+			continue
+		}
+		if version != 0 {
+			return 0, severalIfMatch
+		}
+		version = tagVersion
+	}
+	if version == 0 {
+		return 0, unmatchedIfMatch
+	}
+	return version, nil
+}
+
+// opaqueTag unquotes an RFC 9110 opaque-tag.
+func opaqueTag(tag string) (string, bool) {
+	if len(tag) < 2 || tag[0] != '"' || tag[len(tag)-1] != '"' {
+		return "", false
+	}
+	opaque := tag[1 : len(tag)-1]
+	for i := 0; i < len(opaque); i++ {
+		if b := opaque[i]; b == '"' || b < 0x21 || b == 0x7f {
+			return "", false
+		}
+	}
+	return opaque, true
+}
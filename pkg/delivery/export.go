@@ -0,0 +1,244 @@
+package delivery
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"github.com/labstack/echo/v4"
+	"github.com/mao360/musicLib/models"
+	"github.com/sirupsen/logrus"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	exportFormatNDJSON = "ndjson"
+	exportFormatCSV    = "csv"
+	exportFormatJSON   = "json"
+
+	// exportFlushEvery is how many songs are written between flushes.
+	exportFlushEvery = 100
+)
+
+var unsupportedExportFormat = echo.NewHTTPError(406, "unsupported export format, use ndjson, csv or json")
+
+var exportMIMETypes = map[string]string{
+	exportFormatNDJSON: mimeNDJSON,
+	exportFormatCSV:    mimeCSV,
+	exportFormatJSON:   echo.MIMEApplicationJSON,
+}
+
+// exportFormat takes the format query parameter or the first Accept media
+// type that can be exported. NDJSON is the default.
+func exportFormat(c echo.Context) (string, error) {
+	if format := c.QueryParam("format"); format != "" {
+		if _, ok := exportMIMETypes[format]; !ok {
+			return "", unsupportedExportFormat
+		}
+		return format, nil
+	}
+	accept := c.Request().Header.Get(echo.HeaderAccept)
+	if accept == "" {
+		return exportFormatNDJSON, nil
+	}
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mediaType {
+		case mimeNDJSON, "application/jsonl", "*/*", "application/*":
+			return exportFormatNDJSON, nil
+		case mimeCSV, "text/*":
+			return exportFormatCSV, nil
+		case echo.MIMEApplicationJSON:
+			return exportFormatJSON, nil
+		}
+	}
+	return "", unsupportedExportFormat
+}
+
+// songWriter encodes the exported songs one by one.
+type songWriter interface {
+	write(song models.Song) error
+	close() error
+}
+
+func newSongWriter(format string, w io.Writer) songWriter {
+	switch format {
+	case exportFormatCSV:
+		return &csvSongWriter{writer: csv.NewWriter(w)}
+	case exportFormatJSON:
+		return &jsonSongWriter{w: w}
+	default:
+		return &ndjsonSongWriter{encoder: json.NewEncoder(w)}
+	}
+}
+
+type ndjsonSongWriter struct {
+	encoder *json.Encoder
+}
+
+func (w *ndjsonSongWriter) write(song models.Song) error {
+	return w.encoder.Encode(song)
+}
+
+func (w *ndjsonSongWriter) close() error {
+	return nil
+}
+
+// jsonSongWriter writes a JSON array, opening it with the first song.
+type jsonSongWriter struct {
+	w       io.Writer
+	started bool
+}
+
+func (w *jsonSongWriter) write(song models.Song) error {
+	separator := ","
+	if !w.started {
+		separator = "["
+		w.started = true
+	}
+	if _, err := io.WriteString(w.w, separator); err != nil {
+		return err
+	}
+	return json.NewEncoder(w.w).Encode(song)
+}
+
+func (w *jsonSongWriter) close() error {
+	if !w.started {
+		_, err := io.WriteString(w.w, "[]\n")
+		return err
+	}
+	_, err := io.WriteString(w.w, "]\n")
+	return err
+}
+
+// csvSongWriter writes a header row named like the models.Song JSON fields,
+// which POST /songs/import reads back.
+type csvSongWriter struct {
+	writer  *csv.Writer
+	started bool
+}
+
+func (w *csvSongWriter) write(song models.Song) error {
+	if !w.started {
+		w.started = true
+		if err := w.writer.Write([]string{"id", "artistId", "group", "song", "text", "releaseDate", "link", "createdAt", "updatedAt"}); err != nil {
+			return err
+		}
+	}
+	return w.writer.Write([]string{
+		strconv.Itoa(song.ID),
+		strconv.Itoa(song.ArtistID),
+		song.Group,
+		song.Song,
+		song.Text,
+		song.ReleaseDate,
+		song.Link,
+		song.CreatedAt.Format(time.RFC3339),
+		song.UpdatedAt.Format(time.RFC3339),
+	})
+}
+
+func (w *csvSongWriter) close() error {
+	w.writer.Flush()
+	return w.writer.Error()
+}
+
+// @Summary Export songs
+// @Description Stream every song matching the GET /songs filters as NDJSON, CSV or a JSON array. The format is taken from the format parameter or the Accept header, NDJSON by default
+// @Produce application/x-ndjson
+// @Produce text/csv
+// @Produce json
+// @Param format query string false "ndjson, csv or json (optional)"
+// @Param sort query string false "Comma separated sort fields, prefix - for descending: id, group_name, song_name, release_date, link, created_at, updated_at (optional)"
+// @Param group_name query string false "The group_name query parameter (optional)"
+// @Param song_name query string false "The song_name query parameter (optional)"
+// @Param song_text query string false "The song_text query parameter (optional)"
+// @Param release_date query string false "The release_date query parameter, a year (optional)"
+// @Param year query string false "Songs released in the year, e.g. 1999 (optional)"
+// @Param decade query string false "Songs released in the decade, e.g. 1990 or 1990s (optional)"
+// @Param released_after query string false "Songs released on or after the date, dd.mm.yyyy (optional)"
+// @Param released_before query string false "Songs released on or before the date, dd.mm.yyyy (optional)"
+// @Param link query string false "The link query parameter (optional)"
+// @Param artist_id query string false "The artist_id query parameter (optional)"
+// @Param album_id query string false "The album_id query parameter (optional)"
+// @Param group_name_match query string false "How group_name is matched: exact, contains or fuzzy (optional)"
+// @Param song_name_match query string false "How song_name is matched: exact, contains or fuzzy (optional)"
+// @Success 200 {array} models.Song
+// @Failure 400 {object} models.Problem
+// @Failure 406 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Router /songs/export [get]
+func (h *Handler) ExportSongs(c echo.Context) error {
+	h.logger.WithFields(logrus.Fields{
+		"handler": "ExportSongs",
+	}).Infof("started")
+	format, err := exportFormat(c)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"layer":    "delivery",
+			"handler":  "ExportSongs",
+			"function": "exportFormat",
+		}).Errorf("err: %v", err)
+		return err
+	}
+	filters, matches := songFilters(c)
+	sort := c.QueryParam("sort")
+	h.logger.Debugf("format=%s filters=%v matches=%v sort=%s", format, filters, matches, sort)
+
+	// The status is sent with the first song so that an invalid filter still
+	// gets an error response.
+	resp := c.Response()
+	writer := newSongWriter(format, resp)
+	commit := func() {
+		resp.Header().Set(echo.HeaderContentType, exportMIMETypes[format])
+		resp.Header().Set(echo.HeaderContentDisposition, "attachment; filename=songs."+format)
+		resp.WriteHeader(200)
+	}
+	exported := 0
+	err = h.service.ExportSongs(c.Request().Context(), filters, matches, sort, func(song models.Song) error {
+		if !resp.Committed {
+			commit()
+		}
+		if err := writer.write(song); err != nil {
+			return err
+		}
+		exported++
+		if exported%exportFlushEvery == 0 {
+			resp.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"layer":    "delivery",
+			"handler":  "ExportSongs",
+			"function": "service.ExportSongs",
+		}).Errorf("err: %v", err)
+		if resp.Committed {
+			// Too late for an error status, the client gets a truncated file.
+			return nil
+		}
+		return err
+	}
+	if !resp.Committed {
+		commit()
+	}
+	if err = writer.close(); err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"layer":    "delivery",
+			"handler":  "ExportSongs",
+			"function": "writer.close",
+		}).Errorf("err: %v", err)
+		return nil
+	}
+	h.logger.Debugf("exported songs=%d", exported)
+	h.logger.WithFields(logrus.Fields{
+		"handler": "ExportSongs",
+	}).Infof("finished")
+	return nil
+}
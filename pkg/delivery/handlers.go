@@ -6,8 +6,9 @@ import (
 	"github.com/labstack/echo/v4"
 	"github.com/mao360/musicLib/models"
 	"github.com/mao360/musicLib/pkg/service"
+	"github.com/mao360/musicLib/pkg/songinfo"
 	"github.com/sirupsen/logrus"
-	"net/http"
+	"time"
 )
 
 type HandlerInterface interface {
@@ -15,31 +16,81 @@ type HandlerInterface interface {
 	GetText(c echo.Context) error
 	DeleteSong(c echo.Context) error
 	ChangeSong(c echo.Context) error
+	PatchSong(c echo.Context) error
 	AddSong(c echo.Context) error
+	ImportSongs(c echo.Context) error
+	ExportSongs(c echo.Context) error
+
+	GetSongRevisions(c echo.Context) error
+	DiffSongRevisions(c echo.Context) error
+	RevertSong(c echo.Context) error
+
+	HandleError(err error, c echo.Context)
+
+	GetTrash(c echo.Context) error
+	RestoreSong(c echo.Context) error
+	PurgeSong(c echo.Context) error
+
+	GetDeadEnrichmentJobs(c echo.Context) error
+	RequeueEnrichmentJob(c echo.Context) error
+	InvalidateSongInfoCache(c echo.Context) error
+
+	GetArtists(c echo.Context) error
+	GetArtist(c echo.Context) error
+	AddArtist(c echo.Context) error
+	RenameArtist(c echo.Context) error
+	DeleteArtist(c echo.Context) error
+
+	GetAlbum(c echo.Context) error
+	AddAlbum(c echo.Context) error
+	GetAlbumTracks(c echo.Context) error
+	AttachTrack(c echo.Context) error
+	ReorderTracks(c echo.Context) error
+
+	SearchSongs(c echo.Context) error
 }
 
 type Handler struct {
-	service               service.ServiceInterface
-	externalServiceDomain string
-	logger                *logrus.Logger
+	service       service.ServiceInterface
+	songInfo      songinfo.ClientInterface
+	songInfoCache songinfo.CacheInterface
+	logger        *logrus.Logger
+	// asyncEnrichment makes AddSong answer 202 without Prefer: respond-async.
+	asyncEnrichment bool
 }
 
-func NewHandler(service service.ServiceInterface, logger *logrus.Logger, domain string) *Handler {
-	return &Handler{service, domain, logger}
+func NewHandler(service service.ServiceInterface, logger *logrus.Logger, songInfo songinfo.ClientInterface,
+	songInfoCache songinfo.CacheInterface, asyncEnrichment bool) *Handler {
+	return &Handler{service, songInfo, songInfoCache, logger, asyncEnrichment}
 }
 
 // @Summary Get all song
-// @Description Get all songs, use filters
+// @Description Get all songs, use filters. Without page the songs are paged by cursor, fuzzy matches fall back to the first page. Links to the neighbouring pages are returned in the envelope and in the Link header
 // @Produce json
-// @Param page query string true "The page query parameter (required)"
+// @Param page query string false "The page query parameter (optional, offset pagination)"
 // @Param pageSize query string true "The pageSize query parameter (required)"
+// @Param sort query string false "Comma separated sort fields, prefix - for descending: id, group_name, song_name, release_date, link, created_at, updated_at (optional)"
+// @Param cursor query string false "The cursor query parameter from the next or prev link (optional, cursor pagination)"
 // @Param group_name query string false "The group_name query parameter (optional)"
 // @Param song_name query string false "The song_name query parameter (optional)"
 // @Param song_text query string false "The song_text query parameter (optional)"
-// @Param release_date query string false "The release_date query parameter (optional)"
+// @Param release_date query string false "The release_date query parameter, a year (optional)"
+// @Param year query string false "Songs released in the year, e.g. 1999 (optional)"
+// @Param decade query string false "Songs released in the decade, e.g. 1990 or 1990s (optional)"
+// @Param released_after query string false "Songs released on or after the date, dd.mm.yyyy (optional)"
+// @Param released_before query string false "Songs released on or before the date, dd.mm.yyyy (optional)"
 // @Param link query string false "The link query parameter (optional)"
-// @Sucess 200 {object} []models.Song
-// @Failure 500 {object} error
+// @Param artist_id query string false "The artist_id query parameter (optional)"
+// @Param album_id query string false "The album_id query parameter (optional)"
+// @Param group_name_match query string false "How group_name is matched: exact, contains or fuzzy (optional)"
+// @Param song_name_match query string false "How song_name is matched: exact, contains or fuzzy (optional)"
+// @Param If-None-Match header string false "ETag of a cached response (optional)"
+// @Success 200 {object} models.Page{items=[]models.Song}
+// @Success 304 "Not modified"
+// @Header 200 {string} Link "Links to the next and previous pages"
+// @Header 200 {string} ETag "Hash of the page"
+// @Failure 400 {object} models.Problem
+// @Failure 500 {object} models.Problem
 // @Router /songs [get]
 func (h *Handler) GetSongsByFilter(c echo.Context) error {
 	h.logger.WithFields(logrus.Fields{
@@ -48,43 +99,77 @@ func (h *Handler) GetSongsByFilter(c echo.Context) error {
 
 	pageNum := c.QueryParam("page")
 	pageSize := c.QueryParam("pageSize")
+	cursor := c.QueryParam("cursor")
+	sort := c.QueryParam("sort")
 
-	group := c.QueryParam("group_name")
-	song := c.QueryParam("song_name")
-	text := c.QueryParam("song_text")
-	releaseDate := c.QueryParam("release_date")
-	link := c.QueryParam("link")
-
-	filters := map[string]string{
-		"group_name":   group,
-		"song_name":    song,
-		"song_text":    text,
-		"release_date": releaseDate,
-		"link":         link,
-	}
-	h.logger.Debugf("filters=%v, pageSize=%s, pageNum=%s", filters, pageSize, pageNum)
-	songs, err := h.service.GetSongsByFilter(filters, pageSize, pageNum)
+	filters, matches := songFilters(c)
+	h.logger.Debugf("filters=%v, matches=%v, sort=%s, pageSize=%s, pageNum=%s, cursor=%s", filters, matches, sort, pageSize, pageNum, cursor)
+	page, err := h.service.GetSongsByFilter(c.Request().Context(), filters, matches, sort, pageSize, pageNum, cursor)
 	if err != nil {
 		h.logger.WithFields(logrus.Fields{
 			"layer":    "delivery",
 			"handler":  "GetSongsByFilter",
 			"function": "service.GetSongsByFilter",
 		}).Errorf("err: %v", err)
-		return c.String(500, err.Error())
+		return err
 	}
-	h.logger.Debugf("songs: %v", songs)
-	if err = c.JSON(200, songs); err != nil {
+	h.logger.Debugf("songs: %v", page.Items)
+	setPageLinks(c, &page)
+	body, err := json.Marshal(page)
+	if err != nil {
 		h.logger.WithFields(logrus.Fields{
 			"layer":    "delivery",
 			"handler":  "GetSongsByFilter",
-			"function": "c.JSON",
+			"function": "json.Marshal",
 		}).Errorf("err: %v", err)
-		return c.String(500, err.Error())
+		return err
+	}
+	// No Last-Modified: songs leaving the page, trashed ones included, change
+	// it without making any of its songs newer. The body ETag sees them.
+	if notModified(c, bodyETag(body), time.Time{}) {
+		h.logger.WithFields(logrus.Fields{
+			"handler": "GetSongsByFilter",
+		}).Infof("finished, not modified")
+		return c.NoContent(304)
 	}
 	h.logger.WithFields(logrus.Fields{
 		"handler": "GetSongsByFilter",
 	}).Infof("finished")
-	return c.String(200, "ok")
+	return c.JSONBlob(200, body)
+}
+
+// songFilters reads the GET /songs filter and match query parameters.
+func songFilters(c echo.Context) (map[string]string, map[string]string) {
+	group := c.QueryParam("group_name")
+	song := c.QueryParam("song_name")
+	text := c.QueryParam("song_text")
+	releaseDate := c.QueryParam("release_date")
+	year := c.QueryParam("year")
+	decade := c.QueryParam("decade")
+	releasedAfter := c.QueryParam("released_after")
+	releasedBefore := c.QueryParam("released_before")
+	link := c.QueryParam("link")
+	artistID := c.QueryParam("artist_id")
+	albumID := c.QueryParam("album_id")
+
+	filters := map[string]string{
+		"group_name":      group,
+		"song_name":       song,
+		"song_text":       text,
+		"release_date":    releaseDate,
+		"year":            year,
+		"decade":          decade,
+		"released_after":  releasedAfter,
+		"released_before": releasedBefore,
+		"link":            link,
+		"artist_id":       artistID,
+		"album_id":        albumID,
+	}
+	matches := map[string]string{
+		"group_name": c.QueryParam("group_name_match"),
+		"song_name":  c.QueryParam("song_name_match"),
+	}
+	return filters, matches
 }
 
 // @Summary Get text
@@ -93,8 +178,15 @@ func (h *Handler) GetSongsByFilter(c echo.Context) error {
 // @Param page query string true "The page query parameter (required)"
 // @Param pageSize query string true "The pageSize query parameter (required)"
 // @Param id path string true "ID"
-// @Sucess 200 {object} string
-// @Failure 500 {object} error
+// @Param If-None-Match header string false "ETag of a cached response (optional)"
+// @Param If-Modified-Since header string false "Last-Modified of a cached response (optional)"
+// @Success 200 {object} models.SongText
+// @Success 304 "Not modified"
+// @Header 200 {string} ETag "Version of the song, send it in If-Match to change the song"
+// @Header 200 {string} Last-Modified "When the song was changed last"
+// @Failure 400 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 500 {object} models.Problem
 // @Router /song/{id} [get]
 func (h *Handler) GetText(c echo.Context) error {
 	h.logger.WithFields(logrus.Fields{
@@ -106,49 +198,61 @@ func (h *Handler) GetText(c echo.Context) error {
 	songID := c.Param("id")
 
 	h.logger.Debugf("songID=%s pageSize=%s pageNum=%s", songID, pageSize, pageNum)
-	text, err := h.service.GetTextByID(songID, pageSize, pageNum)
+	text, err := h.service.GetTextByID(c.Request().Context(), songID, pageSize, pageNum)
 	if err != nil {
 		h.logger.WithFields(logrus.Fields{
 			"layer":    "delivery",
 			"handler":  "GetText",
 			"function": "service.SearchSongByID",
 		}).Errorf("err: %v", err)
-		return c.String(500, err.Error())
+		return err
 	}
-	h.logger.Debugf("text: %s", text)
-	if err = c.JSON(200, text); err != nil {
+	h.logger.Debugf("text: %s", text.Text)
+	if notModified(c, songETag(text.Version), text.UpdatedAt) {
 		h.logger.WithFields(logrus.Fields{
-			"layer":    "delivery",
-			"handler":  "GetText",
-			"function": "c.JSON",
-		}).Errorf("err: %v", err)
-		return c.String(500, err.Error())
+			"handler": "GetText",
+		}).Infof("finished, not modified")
+		return c.NoContent(304)
 	}
 	h.logger.WithFields(logrus.Fields{
 		"handler": "GetText",
 	}).Infof("finished")
-	return c.String(200, "ok")
+	return c.JSON(200, text)
 }
 
 // @Summary Delete Song
-// @Description Delete song from db
+// @Description Move song to the trash, it is purged after the retention window
 // @Param id path string true "ID"
+// @Param If-Match header string true "ETag of the song version being deleted, or *"
 // @Sucess 200 {object} string
-// @Failure 500 {object} error
+// @Failure 400 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 412 {object} models.Problem
+// @Failure 428 {object} models.Problem
+// @Failure 500 {object} models.Problem
 // @Router /song/{id} [delete]
 func (h *Handler) DeleteSong(c echo.Context) error {
 	h.logger.WithFields(logrus.Fields{
 		"handler": "DeleteSong",
 	}).Infof("started")
 	songId := c.Param("id")
-	h.logger.Debugf("songId=%s", songId)
-	if err := h.service.DeleteSongByID(songId); err != nil {
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"layer":    "delivery",
+			"handler":  "DeleteSong",
+			"function": "ifMatchVersion",
+		}).Errorf("err: %v", err)
+		return err
+	}
+	h.logger.Debugf("songId=%s version=%d", songId, version)
+	if err = h.service.DeleteSongByID(c.Request().Context(), songId, version); err != nil {
 		h.logger.WithFields(logrus.Fields{
 			"layer":    "delivery",
 			"handler":  "DeleteSong",
 			"function": "service.DeleteSongByID",
 		}).Errorf("err: %v", err)
-		return c.String(500, err.Error())
+		return err
 	}
 	h.logger.WithFields(logrus.Fields{
 		"handler": "DeleteSong",
@@ -156,14 +260,23 @@ func (h *Handler) DeleteSong(c echo.Context) error {
 	return c.String(200, "ok")
 }
 
-// @Summary Delete Song
-// @Description Delete song from db
-// @Param requestBody body models.Song true "JSON payload for creating a resource"
+// @Summary Change Song
+// @Description Change song in db
+// @Param requestBody body models.Song true "JSON payload for changing a resource"
 // @Accept json
+// @Produce json
 // @Param id path string true "ID"
-// @Sucess 200 string
-// @Failure 500 {object} error
-// @Router /song/{id} [delete]
+// @Param If-Match header string true "ETag of the song version being changed, or *"
+// @Success 200 {object} models.Song
+// @Header 200 {string} ETag "New version of the song"
+// @Failure 400 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 409 {object} models.Problem
+// @Failure 412 {object} models.Problem
+// @Failure 413 {object} models.Problem
+// @Failure 428 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Router /song/{id} [put]
 func (h *Handler) ChangeSong(c echo.Context) error {
 	h.logger.WithFields(logrus.Fields{
 		"handler": "ChangeSong",
@@ -175,31 +288,53 @@ func (h *Handler) ChangeSong(c echo.Context) error {
 			"handler":  "ChangeSong",
 			"function": "c.Bind",
 		}).Errorf("err: %v", err)
-		return c.String(500, err.Error())
+		return err
 	}
 	songID := c.Param("id")
-	h.logger.Debugf("songID=%s song=%s group=%s link=%s release=%s text=%s", songID, song.Song, song.Group, song.Link, song.ReleaseDate, song.Text)
-	if err := h.service.ChangeSongByID(songID, song); err != nil {
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"layer":    "delivery",
+			"handler":  "ChangeSong",
+			"function": "ifMatchVersion",
+		}).Errorf("err: %v", err)
+		return err
+	}
+	h.logger.Debugf("songID=%s version=%d song=%s group=%s link=%s release=%s text=%s", songID, version, song.Song, song.Group, song.Link, song.ReleaseDate, song.Text)
+	changed, err := h.service.ChangeSongByID(c.Request().Context(), songID, version, song)
+	if err != nil {
 		h.logger.WithFields(logrus.Fields{
 			"layer":    "delivery",
 			"handler":  "ChangeSong",
 			"function": "service.ChangeSongByID",
 		}).Errorf("err: %v", err)
-		return c.String(500, err.Error())
+		return err
 	}
+	c.Response().Header().Set(headerETag, songETag(changed.Version))
 	h.logger.WithFields(logrus.Fields{
 		"handler": "ChangeSong",
 	}).Infof("finished")
-	return c.String(200, "ok")
+	return c.JSON(200, changed)
 }
 
 // @Summary Add Song
-// @Description Add Song to db
+// @Description Add Song to db, the details not sent are filled in by the enrichment providers. With Prefer: respond-async the song is stored right away with the pending status and its details are fetched in the background
 // @Accept json
+// @Produce json
 // @Param requestBody body models.Song true "JSON payload for creating a resource"
-// @Sucess 200 {object} []models.Song
-// @Failure 400 {object} error
-// @Failure 500 {object} error
+// @Param Prefer header string false "respond-async to fetch the details in the background"
+// @Success 201 {object} models.Song
+// @Success 202 {object} models.Song
+// @Header 201,202 {string} Location "URL of the created song"
+// @Header 201,202 {string} ETag "Version of the song"
+// @Header 202 {string} Preference-Applied "respond-async"
+// @Failure 400 {object} models.Problem
+// @Failure 409 {object} models.Problem
+// @Failure 413 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Failure 502 {object} models.Problem
+// @Failure 503 {object} models.Problem
+// @Failure 504 {object} models.Problem
 // @Router /song [post]
 func (h *Handler) AddSong(c echo.Context) error {
 	h.logger.WithFields(logrus.Fields{
@@ -213,50 +348,51 @@ func (h *Handler) AddSong(c echo.Context) error {
 			"handler":  "AddSong",
 			"function": "c.Bind",
 		}).Errorf("err: %v", err)
-		return c.String(500, err.Error())
+		return err
 	}
 	h.logger.Debugf("addSong data: song=%s text=%s\n", song.Song, song.Text)
-	outputSong, statusCode, err := SendRequestToExternalService(song, h.externalServiceDomain)
-	if statusCode != 200 {
-		if statusCode == 400 {
+	if h.asyncEnrichment || preferAsync(c) {
+		created, err := h.service.AddPendingSong(c.Request().Context(), song)
+		if err != nil {
 			h.logger.WithFields(logrus.Fields{
 				"layer":    "delivery",
 				"handler":  "AddSong",
-				"function": "SendRequestToExternalService",
-			}).Errorf("400")
-			return c.String(statusCode, "external service 400")
-		} else {
-			h.logger.WithFields(logrus.Fields{
-				"layer":    "delivery",
-				"handler":  "AddSong",
-				"function": "SendRequestToExternalService",
-			}).Errorf("500")
-			return c.String(statusCode, "external service 500")
+				"function": "service.AddPendingSong",
+			}).Errorf("err: %v", err)
+			return err
 		}
+		h.logger.WithFields(logrus.Fields{
+			"handler": "AddSong",
+		}).Infof("finished")
+		c.Response().Header().Set(headerPreferenceApplied, preferRespondAsync)
+		c.Response().Header().Set(echo.HeaderLocation, fmt.Sprintf("/song/%d", created.ID))
+		c.Response().Header().Set(headerETag, songETag(created.Version))
+		return c.JSON(202, created)
+	}
+	info, err := h.songInfo.GetSongInfo(c.Request().Context(), song.Group, song.Song)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"layer":    "delivery",
+			"handler":  "AddSong",
+			"function": "songInfo.GetSongInfo",
+		}).Errorf("err: %v", err)
+		return err
 	}
+	outputSong := songinfo.Merge(song, info)
 	h.logger.Debugf("outputSong: song=%s group=%s release=%s link=%s text=%s", outputSong.Song, outputSong.Group, outputSong.ReleaseDate, outputSong.Link, outputSong.Text)
-	if err = h.service.AddSong(outputSong); err != nil {
+	created, err := h.service.AddSong(c.Request().Context(), outputSong)
+	if err != nil {
 		h.logger.WithFields(logrus.Fields{
 			"layer":    "delivery",
 			"handler":  "AddSong",
 			"function": "service.AddSong",
 		}).Errorf("err: %v", err)
-		return c.String(500, err.Error())
+		return err
 	}
 	h.logger.WithFields(logrus.Fields{
 		"handler": "AddSong",
 	}).Infof("finished")
-	return c.String(200, "ok")
-}
-
-func SendRequestToExternalService(input models.Song, externalServiceDomain string) (models.Song, int, error) {
-	url := fmt.Sprintf("%s/info?group=%s&song=%s", externalServiceDomain, input.Group, input.Song)
-	resp, err := http.Get(url)
-	defer resp.Body.Close()
-	song := models.Song{}
-	err = json.NewDecoder(resp.Body).Decode(&song)
-	if err != nil {
-		return models.Song{}, 0, err
-	}
-	return song, resp.StatusCode, nil
+	c.Response().Header().Set(echo.HeaderLocation, fmt.Sprintf("/song/%d", created.ID))
+	c.Response().Header().Set(headerETag, songETag(created.Version))
+	return c.JSON(201, created)
 }
@@ -0,0 +1,65 @@
+package delivery
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/mao360/musicLib/pkg/service"
+	"github.com/sirupsen/logrus"
+	"mime"
+)
+
+const (
+	mimeCSV    = "text/csv"
+	mimeNDJSON = "application/x-ndjson"
+)
+
+// importFormat takes the format query parameter or, without it, guesses the
+// format from the content type.
+func importFormat(c echo.Context) string {
+	if format := c.QueryParam("format"); format != "" {
+		return format
+	}
+	mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	switch mediaType {
+	case mimeCSV:
+		return service.ImportFormatCSV
+	case mimeNDJSON, "application/jsonl":
+		return service.ImportFormatNDJSON
+	}
+	return ""
+}
+
+// @Summary Import songs
+// @Description Import songs from a CSV file with a header row (group, song, text, releaseDate, link) or from NDJSON, one song per line. Returns a report for every row: created, skipped as duplicate or invalid. Rows are stored in batches, an import failing halfway answers a problem whose report member lists the rows handled so far
+// @Accept text/csv
+// @Accept application/x-ndjson
+// @Produce json
+// @Param format query string false "csv or ndjson, taken from the content type if omitted (optional)"
+// @Param requestBody body string true "CSV or NDJSON file"
+// @Success 200 {object} models.ImportReport
+// @Failure 400 {object} models.Problem
+// @Failure 413 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Router /songs/import [post]
+func (h *Handler) ImportSongs(c echo.Context) error {
+	h.logger.WithFields(logrus.Fields{
+		"handler": "ImportSongs",
+	}).Infof("started")
+	format := importFormat(c)
+	h.logger.Debugf("format=%s", format)
+	report, err := h.service.ImportSongs(c.Request().Context(), c.Request().Body, format)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"layer":    "delivery",
+			"handler":  "ImportSongs",
+			"function": "service.ImportSongs",
+		}).Errorf("err: %v", err)
+		if len(report.Rows) != 0 {
+			return &importError{err, report}
+		}
+		return err
+	}
+	h.logger.WithFields(logrus.Fields{
+		"handler": "ImportSongs",
+	}).Infof("finished")
+	return c.JSON(200, report)
+}
@@ -0,0 +1,61 @@
+package delivery
+
+import (
+	"fmt"
+	"github.com/labstack/echo/v4"
+	"github.com/mao360/musicLib/models"
+	"strconv"
+	"strings"
+)
+
+// pageURL returns the request URL pointing to the given page number.
+func pageURL(c echo.Context, page int) string {
+	u := *c.Request().URL
+	query := u.Query()
+	query.Del("cursor")
+	query.Set("page", strconv.Itoa(page))
+	u.RawQuery = query.Encode()
+	return u.RequestURI()
+}
+
+// cursorURL returns the request URL with its cursor query parameter replaced.
+func cursorURL(c echo.Context, cursor string) string {
+	u := *c.Request().URL
+	query := u.Query()
+	query.Del("page")
+	query.Set("cursor", cursor)
+	u.RawQuery = query.Encode()
+	return u.RequestURI()
+}
+
+// setPageLinks fills the next and previous page links of the envelope and
+// mirrors them in an RFC 8288 Link header. Pages taken by number link to the
+// neighbouring numbers, keyset pages link through their cursors.
+func setPageLinks(c echo.Context, page *models.Page) {
+	if page.Page != 0 {
+		if page.Page*page.PageSize < page.Total {
+			page.Next = pageURL(c, page.Page+1)
+		}
+		if page.Page > 1 {
+			page.Prev = pageURL(c, page.Page-1)
+		}
+	} else {
+		if page.NextCursor != "" {
+			page.Next = cursorURL(c, page.NextCursor)
+		}
+		if page.PrevCursor != "" {
+			page.Prev = cursorURL(c, page.PrevCursor)
+		}
+	}
+
+	links := make([]string, 0, 2)
+	if page.Next != "" {
+		links = append(links, fmt.Sprintf(`<%s>; rel="next"`, page.Next))
+	}
+	if page.Prev != "" {
+		links = append(links, fmt.Sprintf(`<%s>; rel="prev"`, page.Prev))
+	}
+	if len(links) != 0 {
+		c.Response().Header().Set("Link", strings.Join(links, ", "))
+	}
+}
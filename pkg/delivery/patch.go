@@ -0,0 +1,101 @@
+package delivery
+
+import (
+	"encoding/json"
+	"github.com/labstack/echo/v4"
+	"github.com/mao360/musicLib/pkg/apperrors"
+	"github.com/sirupsen/logrus"
+	"mime"
+)
+
+const mimeMergePatch = "application/merge-patch+json"
+
+var notStringField = apperrors.New(apperrors.Validation, "patch fields must be strings or null")
+
+// decodeMergePatch reads a JSON merge patch object. Every member has to be a
+// string or null, null is returned as a nil value.
+func decodeMergePatch(c echo.Context) (map[string]*string, error) {
+	raw := make(map[string]json.RawMessage)
+	if err := json.NewDecoder(c.Request().Body).Decode(&raw); err != nil {
+		return nil, apperrors.Wrap(apperrors.Validation, "invalid merge patch", err)
+	}
+	patch := make(map[string]*string, len(raw))
+	for field, value := range raw {
+		if string(value) == "null" {
+			patch[field] = nil
+			continue
+		}
+		var str string
+		if err := json.Unmarshal(value, &str); err != nil {
+			return nil, notStringField
+		}
+		patch[field] = &str
+	}
+	return patch, nil
+}
+
+// @Summary Patch Song
+// @Description Change only the song fields present in the JSON merge patch (RFC 7396), null clears a field
+// @Accept application/merge-patch+json
+// @Produce json
+// @Param requestBody body models.Song true "JSON merge patch with the fields to change"
+// @Param id path string true "ID"
+// @Param If-Match header string true "ETag of the song version being changed, or *"
+// @Success 200 {object} models.Song
+// @Header 200 {string} ETag "New version of the song"
+// @Failure 400 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 409 {object} models.Problem
+// @Failure 412 {object} models.Problem
+// @Failure 413 {object} models.Problem
+// @Failure 415 {object} models.Problem
+// @Failure 428 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Router /song/{id} [patch]
+func (h *Handler) PatchSong(c echo.Context) error {
+	h.logger.WithFields(logrus.Fields{
+		"handler": "PatchSong",
+	}).Infof("started")
+	mediaType, _, _ := mime.ParseMediaType(c.Request().Header.Get(echo.HeaderContentType))
+	if mediaType != mimeMergePatch && mediaType != echo.MIMEApplicationJSON {
+		h.logger.WithFields(logrus.Fields{
+			"layer":   "delivery",
+			"handler": "PatchSong",
+		}).Errorf("unsupported content type %q", mediaType)
+		return echo.NewHTTPError(415, "unsupported content type, use "+mimeMergePatch)
+	}
+	patch, err := decodeMergePatch(c)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"layer":    "delivery",
+			"handler":  "PatchSong",
+			"function": "decodeMergePatch",
+		}).Errorf("err: %v", err)
+		return err
+	}
+	songID := c.Param("id")
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"layer":    "delivery",
+			"handler":  "PatchSong",
+			"function": "ifMatchVersion",
+		}).Errorf("err: %v", err)
+		return err
+	}
+	h.logger.Debugf("songID=%s version=%d patch fields=%d", songID, version, len(patch))
+	patched, err := h.service.PatchSongByID(c.Request().Context(), songID, version, patch)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"layer":    "delivery",
+			"handler":  "PatchSong",
+			"function": "service.PatchSongByID",
+		}).Errorf("err: %v", err)
+		return err
+	}
+	c.Response().Header().Set(headerETag, songETag(patched.Version))
+	h.logger.WithFields(logrus.Fields{
+		"handler": "PatchSong",
+	}).Infof("finished")
+	return c.JSON(200, patched)
+}
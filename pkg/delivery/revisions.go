@@ -0,0 +1,116 @@
+package delivery
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// @Summary Get song revisions
+// @Description Get every saved revision of a song, the newest first
+// @Produce json
+// @Param id path string true "ID"
+// @Success 200 {array} models.SongRevision
+// @Failure 400 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Router /song/{id}/revisions [get]
+func (h *Handler) GetSongRevisions(c echo.Context) error {
+	h.logger.WithFields(logrus.Fields{
+		"handler": "GetSongRevisions",
+	}).Infof("started")
+	songID := c.Param("id")
+	h.logger.Debugf("songID=%s", songID)
+	revisions, err := h.service.GetSongRevisions(c.Request().Context(), songID)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"layer":    "delivery",
+			"handler":  "GetSongRevisions",
+			"function": "service.GetSongRevisions",
+		}).Errorf("err: %v", err)
+		return err
+	}
+	h.logger.WithFields(logrus.Fields{
+		"handler": "GetSongRevisions",
+	}).Infof("finished")
+	return c.JSON(200, revisions)
+}
+
+// @Summary Diff song revisions
+// @Description Get the fields changed between two revisions of a song, with a line diff for the text
+// @Produce json
+// @Param id path string true "ID"
+// @Param from query string true "The revision to compare from (required)"
+// @Param to query string true "The revision to compare to (required)"
+// @Success 200 {object} models.SongDiff
+// @Failure 400 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Router /song/{id}/revisions/diff [get]
+func (h *Handler) DiffSongRevisions(c echo.Context) error {
+	h.logger.WithFields(logrus.Fields{
+		"handler": "DiffSongRevisions",
+	}).Infof("started")
+	songID := c.Param("id")
+	from := c.QueryParam("from")
+	to := c.QueryParam("to")
+	h.logger.Debugf("songID=%s from=%s to=%s", songID, from, to)
+	diff, err := h.service.DiffSongRevisions(c.Request().Context(), songID, from, to)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"layer":    "delivery",
+			"handler":  "DiffSongRevisions",
+			"function": "service.DiffSongRevisions",
+		}).Errorf("err: %v", err)
+		return err
+	}
+	h.logger.WithFields(logrus.Fields{
+		"handler": "DiffSongRevisions",
+	}).Infof("finished")
+	return c.JSON(200, diff)
+}
+
+// @Summary Revert Song
+// @Description Restore the song fields saved in an earlier revision, the revert is saved as a new revision
+// @Produce json
+// @Param id path string true "ID"
+// @Param revision path string true "Revision"
+// @Param If-Match header string true "ETag of the song version being reverted, or *"
+// @Success 200 {object} models.Song
+// @Header 200 {string} ETag "New version of the song"
+// @Failure 400 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 412 {object} models.Problem
+// @Failure 428 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Router /song/{id}/revisions/{revision}/revert [post]
+func (h *Handler) RevertSong(c echo.Context) error {
+	h.logger.WithFields(logrus.Fields{
+		"handler": "RevertSong",
+	}).Infof("started")
+	songID := c.Param("id")
+	revision := c.Param("revision")
+	version, err := ifMatchVersion(c)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"layer":    "delivery",
+			"handler":  "RevertSong",
+			"function": "ifMatchVersion",
+		}).Errorf("err: %v", err)
+		return err
+	}
+	h.logger.Debugf("songID=%s revision=%s version=%d", songID, revision, version)
+	reverted, err := h.service.RevertSong(c.Request().Context(), songID, revision, version)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"layer":    "delivery",
+			"handler":  "RevertSong",
+			"function": "service.RevertSong",
+		}).Errorf("err: %v", err)
+		return err
+	}
+	c.Response().Header().Set(headerETag, songETag(reverted.Version))
+	h.logger.WithFields(logrus.Fields{
+		"handler": "RevertSong",
+	}).Infof("finished")
+	return c.JSON(200, reverted)
+}
@@ -0,0 +1,45 @@
+package delivery
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// @Summary Search songs
+// @Description Full-text search over song names and lyrics, results are ranked and contain highlighted snippets: HTML-escaped lyrics with matches wrapped in <b></b>
+// @Produce json
+// @Param q query string true "The search query, supports quotes, OR and -exclusion (required)"
+// @Param lang query string false "The text search language: ru or en (optional)"
+// @Param page query string true "The page query parameter (required)"
+// @Param pageSize query string true "The pageSize query parameter (required)"
+// @Success 200 {object} models.Page{items=[]models.SearchResult}
+// @Header 200 {string} Link "Links to the next and previous pages"
+// @Failure 400 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Router /songs/search [get]
+func (h *Handler) SearchSongs(c echo.Context) error {
+	h.logger.WithFields(logrus.Fields{
+		"handler": "SearchSongs",
+	}).Infof("started")
+
+	query := c.QueryParam("q")
+	lang := c.QueryParam("lang")
+	pageNum := c.QueryParam("page")
+	pageSize := c.QueryParam("pageSize")
+
+	h.logger.Debugf("q=%s lang=%s pageSize=%s pageNum=%s", query, lang, pageSize, pageNum)
+	page, err := h.service.SearchSongs(c.Request().Context(), query, lang, pageSize, pageNum)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"layer":    "delivery",
+			"handler":  "SearchSongs",
+			"function": "service.SearchSongs",
+		}).Errorf("err: %v", err)
+		return err
+	}
+	setPageLinks(c, &page)
+	h.logger.WithFields(logrus.Fields{
+		"handler": "SearchSongs",
+	}).Infof("finished")
+	return c.JSON(200, page)
+}
@@ -0,0 +1,99 @@
+package delivery
+
+import (
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+)
+
+// @Summary Get trash
+// @Description Get the deleted songs with pagination, the latest deleted first. purgeAt is when the song is removed for good
+// @Produce json
+// @Param page query string true "The page query parameter (required)"
+// @Param pageSize query string true "The pageSize query parameter (required)"
+// @Success 200 {object} models.Page{items=[]models.TrashedSong}
+// @Header 200 {string} Link "Links to the next and previous pages"
+// @Failure 400 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Router /trash/songs [get]
+func (h *Handler) GetTrash(c echo.Context) error {
+	h.logger.WithFields(logrus.Fields{
+		"handler": "GetTrash",
+	}).Infof("started")
+
+	pageNum := c.QueryParam("page")
+	pageSize := c.QueryParam("pageSize")
+
+	h.logger.Debugf("pageSize=%s, pageNum=%s", pageSize, pageNum)
+	page, err := h.service.GetTrash(c.Request().Context(), pageSize, pageNum)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"layer":    "delivery",
+			"handler":  "GetTrash",
+			"function": "service.GetTrash",
+		}).Errorf("err: %v", err)
+		return err
+	}
+	setPageLinks(c, &page)
+	h.logger.WithFields(logrus.Fields{
+		"handler": "GetTrash",
+	}).Infof("finished")
+	return c.JSON(200, page)
+}
+
+// @Summary Restore Song
+// @Description Move a deleted song out of the trash
+// @Produce json
+// @Param id path string true "ID"
+// @Success 200 {object} models.Song
+// @Failure 400 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Router /trash/song/{id}/restore [post]
+func (h *Handler) RestoreSong(c echo.Context) error {
+	h.logger.WithFields(logrus.Fields{
+		"handler": "RestoreSong",
+	}).Infof("started")
+	songID := c.Param("id")
+	h.logger.Debugf("songID=%s", songID)
+	restored, err := h.service.RestoreSongByID(c.Request().Context(), songID)
+	if err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"layer":    "delivery",
+			"handler":  "RestoreSong",
+			"function": "service.RestoreSongByID",
+		}).Errorf("err: %v", err)
+		return err
+	}
+	h.logger.WithFields(logrus.Fields{
+		"handler": "RestoreSong",
+	}).Infof("finished")
+	return c.JSON(200, restored)
+}
+
+// @Summary Purge Song
+// @Description Delete a song in the trash for good
+// @Param id path string true "ID"
+// @Success 200 {object} string
+// @Failure 400 {object} models.Problem
+// @Failure 404 {object} models.Problem
+// @Failure 500 {object} models.Problem
+// @Router /trash/song/{id} [delete]
+func (h *Handler) PurgeSong(c echo.Context) error {
+	h.logger.WithFields(logrus.Fields{
+		"handler": "PurgeSong",
+	}).Infof("started")
+	songID := c.Param("id")
+	h.logger.Debugf("songID=%s", songID)
+	if err := h.service.PurgeSongByID(c.Request().Context(), songID); err != nil {
+		h.logger.WithFields(logrus.Fields{
+			"layer":    "delivery",
+			"handler":  "PurgeSong",
+			"function": "service.PurgeSongByID",
+		}).Errorf("err: %v", err)
+		return err
+	}
+	h.logger.WithFields(logrus.Fields{
+		"handler": "PurgeSong",
+	}).Infof("finished")
+	return c.String(200, "ok")
+}
@@ -0,0 +1,356 @@
+package postgres
+
+import (
+	"context"
+	"github.com/mao360/musicLib/models"
+	"github.com/mao360/musicLib/pkg/apperrors"
+	"github.com/sirupsen/logrus"
+	"slices"
+	"time"
+)
+
+var (
+	albumAlreadyInDB = apperrors.New(apperrors.Conflict, "album already in db")
+	albumNotFound    = apperrors.New(apperrors.NotFound, "album not found")
+	trackAlreadyInDB = apperrors.New(apperrors.Conflict, "song already on album")
+	invalidTrackList = apperrors.New(apperrors.Validation, "track list does not match album tracks")
+)
+
+const albumsSelect = `SELECT al.id, al.artist_id, a.name, al.title, al.release_date, al.cover_link, al.created_at, al.updated_at
+	FROM albums al
+	JOIN artists a ON a.id = al.artist_id`
+
+// albumRow is the scan target of albumsSelect columns.
+type albumRow struct {
+	album       models.Album
+	releaseDate *time.Time
+}
+
+func (r *albumRow) dest() []interface{} {
+	return []interface{}{&r.album.ID, &r.album.ArtistID, &r.album.Artist, &r.album.Title,
+		&r.releaseDate, &r.album.CoverLink, &r.album.CreatedAt, &r.album.UpdatedAt}
+}
+
+func (r *albumRow) result() models.Album {
+	r.album.ReleaseDate = ""
+	if r.releaseDate != nil {
+		r.album.ReleaseDate = r.releaseDate.Format(ReleaseDateLayout)
+	}
+	return r.album
+}
+
+func (db *DB) SearchAlbumByIDDB(ctx context.Context, id int) (models.Album, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	db.logger.Debugf("search id=%d", id)
+	rows, err := db.conn.Query(ctx,
+		albumsSelect+`
+	WHERE al.id=$1;`, id)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "SearchAlbumByIDDB",
+			"subFunction": "Query()",
+		}).Errorf("error: %s", err.Error())
+		return models.Album{}, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			db.logger.WithFields(logrus.Fields{
+				"layer":       "db",
+				"function":    "SearchAlbumByIDDB",
+				"subFunction": "rows.Err()",
+			}).Errorf("error: %s", err.Error())
+			return models.Album{}, err
+		}
+		db.logger.WithFields(logrus.Fields{
+			"layer":    "db",
+			"function": "SearchAlbumByIDDB",
+		}).Errorf("error: %s", albumNotFound)
+		return models.Album{}, albumNotFound
+	}
+	row := albumRow{}
+	err = rows.Scan(row.dest()...)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "SearchAlbumByIDDB",
+			"subFunction": "Scan()",
+		}).Errorf("error: %s", err.Error())
+		return models.Album{}, err
+	}
+	return row.result(), nil
+}
+
+func (db *DB) AddAlbumDB(ctx context.Context, album models.Album) (models.Album, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	db.logger.Debugf("adding album artistID=%d title=%s", album.ArtistID, album.Title)
+	rows, err := db.conn.Query(ctx,
+		`SELECT id FROM albums WHERE artist_id=$1 AND title=$2;`, album.ArtistID, album.Title)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "AddAlbumDB",
+			"subFunction": "Query()",
+		}).Errorf("error: %s", err.Error())
+		return models.Album{}, err
+	}
+	found := rows.Next()
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "AddAlbumDB",
+			"subFunction": "rows.Err()",
+		}).Errorf("error: %s", err.Error())
+		return models.Album{}, err
+	}
+	if found {
+		db.logger.WithFields(logrus.Fields{
+			"layer":    "db",
+			"function": "AddAlbumDB",
+		}).Errorf("error: %s", albumAlreadyInDB.Error())
+		return models.Album{}, albumAlreadyInDB
+	}
+
+	row := albumRow{}
+	err = db.conn.QueryRow(ctx,
+		`WITH album AS (
+	    INSERT INTO albums (artist_id, title, release_date, cover_link)
+	    VALUES ($1, $2, $3, $4)
+	    RETURNING id, artist_id, title, release_date, cover_link, created_at, updated_at
+	)
+	SELECT al.id, al.artist_id, a.name, al.title, al.release_date, al.cover_link, al.created_at, al.updated_at
+	FROM album al
+	JOIN artists a ON a.id = al.artist_id;`,
+		album.ArtistID, album.Title, releaseDateArg(album.ReleaseDate), album.CoverLink).
+		Scan(row.dest()...)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "AddAlbumDB",
+			"subFunction": "QueryRow()",
+		}).Errorf("error: %s", err.Error())
+		return models.Album{}, err
+	}
+	created := row.result()
+	db.logger.Debugf("created album id=%d", created.ID)
+	return created, nil
+}
+
+func (db *DB) GetAlbumTracksDB(ctx context.Context, albumID int) ([]models.Track, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	db.logger.Debugf("album id=%d", albumID)
+	if _, err := db.SearchAlbumByIDDB(ctx, albumID); err != nil {
+		return nil, err
+	}
+	rows, err := db.conn.Query(ctx,
+		`SELECT t.position, s.id, s.artist_id, a.name, s.song_name, s.song_text, s.release_date, s.link, s.created_at, s.updated_at, s.version, s.status
+	FROM album_tracks t
+	JOIN songs s ON s.id = t.song_id
+	JOIN artists a ON a.id = s.artist_id
+	WHERE t.album_id=$1 AND s.deleted_at IS NULL
+	ORDER BY t.position;`, albumID)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "GetAlbumTracksDB",
+			"subFunction": "Query()",
+		}).Errorf("error: %s", err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+	tracks := make([]models.Track, 0)
+	for rows.Next() {
+		track := models.Track{}
+		row := songRow{}
+		err = rows.Scan(append([]interface{}{&track.Position}, row.dest()...)...)
+		if err != nil {
+			db.logger.WithFields(logrus.Fields{
+				"layer":       "db",
+				"function":    "GetAlbumTracksDB",
+				"subFunction": "Scan()",
+			}).Errorf("error: %s", err.Error())
+			return nil, err
+		}
+		track.Song = row.result()
+		tracks = append(tracks, track)
+	}
+	if err = rows.Err(); err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "GetAlbumTracksDB",
+			"subFunction": "rows.Err()",
+		}).Errorf("error: %s", err.Error())
+		return nil, err
+	}
+	db.logger.Debugf("len of tracks list=%d", len(tracks))
+	return tracks, nil
+}
+
+// AttachTrackDB puts a song on the album at the given position, shifting the
+// following tracks down. A zero position appends the song to the end. Purged
+// songs leave gaps in the positions, so the end is after the last position
+// rather than after the number of tracks.
+func (db *DB) AttachTrackDB(ctx context.Context, albumID int, track models.TrackAttach) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	db.logger.Debugf("album id=%d song id=%d position=%d", albumID, track.SongID, track.Position)
+	if _, err := db.SearchAlbumByIDDB(ctx, albumID); err != nil {
+		return err
+	}
+	if _, err := db.SearchSongByIDDB(ctx, track.SongID); err != nil {
+		return err
+	}
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "AttachTrackDB",
+			"subFunction": "Begin()",
+		}).Errorf("error: %s", err.Error())
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var onAlbum bool
+	var lastPosition int
+	err = tx.QueryRow(ctx,
+		`SELECT COALESCE(bool_or(song_id=$2), false), COALESCE(max(position), 0)
+	FROM album_tracks
+	WHERE album_id=$1;`, albumID, track.SongID).Scan(&onAlbum, &lastPosition)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "AttachTrackDB",
+			"subFunction": "QueryRow()",
+		}).Errorf("error: %s", err.Error())
+		return err
+	}
+	if onAlbum {
+		db.logger.WithFields(logrus.Fields{
+			"layer":    "db",
+			"function": "AttachTrackDB",
+		}).Errorf("error: %s", trackAlreadyInDB.Error())
+		return trackAlreadyInDB
+	}
+	position := track.Position
+	if position == 0 || position > lastPosition+1 {
+		position = lastPosition + 1
+	}
+
+	if _, err = tx.Exec(ctx,
+		`UPDATE album_tracks
+	SET position=position+1
+	WHERE album_id=$1 AND position>=$2;`, albumID, position); err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "AttachTrackDB",
+			"subFunction": "Exec() shift",
+		}).Errorf("error: %s", err.Error())
+		return err
+	}
+	if _, err = tx.Exec(ctx,
+		`INSERT INTO album_tracks (album_id, song_id, position)
+	VALUES ($1, $2, $3);`, albumID, track.SongID, position); err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "AttachTrackDB",
+			"subFunction": "Exec() insert",
+		}).Errorf("error: %s", err.Error())
+		return err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "AttachTrackDB",
+			"subFunction": "Commit()",
+		}).Errorf("error: %s", err.Error())
+		return err
+	}
+	return nil
+}
+
+// ReorderTracksDB renumbers the album tracks in the order of songIDs, which
+// has to contain exactly the songs already on the album and not in the trash.
+func (db *DB) ReorderTracksDB(ctx context.Context, albumID int, songIDs []int) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	db.logger.Debugf("album id=%d songIDs=%v", albumID, songIDs)
+	if _, err := db.SearchAlbumByIDDB(ctx, albumID); err != nil {
+		return err
+	}
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "ReorderTracksDB",
+			"subFunction": "Begin()",
+		}).Errorf("error: %s", err.Error())
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Tracks of songs in the trash are hidden from the list, they keep their
+	// relative order after the reordered ones.
+	var trashed []int
+	err = tx.QueryRow(ctx,
+		`SELECT COALESCE(array_agg(t.song_id ORDER BY t.position), '{}')
+	FROM album_tracks t
+	JOIN songs s ON s.id = t.song_id
+	WHERE t.album_id=$1 AND s.deleted_at IS NOT NULL;`, albumID).Scan(&trashed)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "ReorderTracksDB",
+			"subFunction": "QueryRow() trashed",
+		}).Errorf("error: %s", err.Error())
+		return err
+	}
+	songIDs = append(slices.Clone(songIDs), trashed...)
+
+	commandTag, err := tx.Exec(ctx,
+		`UPDATE album_tracks t
+	SET position=o.position
+	FROM unnest($2::int[]) WITH ORDINALITY AS o(song_id, position)
+	WHERE t.album_id=$1 AND t.song_id=o.song_id;`, albumID, songIDs)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "ReorderTracksDB",
+			"subFunction": "Exec()",
+		}).Errorf("error: %s", err.Error())
+		return err
+	}
+	var tracksCount int
+	err = tx.QueryRow(ctx,
+		`SELECT count(*) FROM album_tracks WHERE album_id=$1;`, albumID).Scan(&tracksCount)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "ReorderTracksDB",
+			"subFunction": "QueryRow() count",
+		}).Errorf("error: %s", err.Error())
+		return err
+	}
+	db.logger.Debugf("rows affected=%d tracks=%d", commandTag.RowsAffected(), tracksCount)
+	if int(commandTag.RowsAffected()) != tracksCount || len(songIDs) != tracksCount {
+		db.logger.WithFields(logrus.Fields{
+			"layer":    "db",
+			"function": "ReorderTracksDB",
+		}).Errorf("error: %s", invalidTrackList.Error())
+		return invalidTrackList
+	}
+	if err = tx.Commit(ctx); err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "ReorderTracksDB",
+			"subFunction": "Commit()",
+		}).Errorf("error: %s", err.Error())
+		return err
+	}
+	return nil
+}
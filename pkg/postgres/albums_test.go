@@ -0,0 +1,86 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	_ "github.com/mao360/musicLib/migrations"
+	"github.com/mao360/musicLib/models"
+	"github.com/sirupsen/logrus"
+	"os"
+	"testing"
+	"time"
+)
+
+// testDB connects to the database in TEST_DATABASE_URL and migrates it, the
+// test is skipped without one.
+func testDB(t *testing.T) *DB {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	logger := logrus.New()
+	logger.SetLevel(logrus.WarnLevel)
+	conn, err := ConnectToDB(url, false, logger)
+	if err != nil {
+		t.Fatalf("ConnectToDB: %v", err)
+	}
+	t.Cleanup(conn.Close)
+	return NewDB(conn, logger, 0)
+}
+
+func TestAttachTrackAppendsAfterPurgedTrack(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+
+	group := fmt.Sprintf("attach test %d", time.Now().UnixNano())
+	songs := make([]models.Song, 4)
+	for i := range songs {
+		song, err := db.AddSongDB(ctx, models.Song{Group: group, Song: fmt.Sprintf("song %d", i+1)})
+		if err != nil {
+			t.Fatalf("AddSongDB: %v", err)
+		}
+		songs[i] = song
+	}
+	t.Cleanup(func() {
+		if err := db.DeleteArtistByIDDB(ctx, songs[0].ArtistID, true); err != nil {
+			t.Errorf("DeleteArtistByIDDB: %v", err)
+		}
+	})
+	album, err := db.AddAlbumDB(ctx, models.Album{ArtistID: songs[0].ArtistID, Title: "album"})
+	if err != nil {
+		t.Fatalf("AddAlbumDB: %v", err)
+	}
+	for _, song := range songs[:3] {
+		if err = db.AttachTrackDB(ctx, album.ID, models.TrackAttach{SongID: song.ID}); err != nil {
+			t.Fatalf("AttachTrackDB: %v", err)
+		}
+	}
+
+	// Purging the second song leaves positions 1 and 3, an append taking the
+	// number of tracks plus one would collide with 3.
+	if err = db.DeleteSongByIDDB(ctx, songs[1].ID, 0); err != nil {
+		t.Fatalf("DeleteSongByIDDB: %v", err)
+	}
+	if err = db.PurgeSongByIDDB(ctx, songs[1].ID); err != nil {
+		t.Fatalf("PurgeSongByIDDB: %v", err)
+	}
+	if err = db.AttachTrackDB(ctx, album.ID, models.TrackAttach{SongID: songs[3].ID}); err != nil {
+		t.Fatalf("AttachTrackDB after purge: %v", err)
+	}
+
+	tracks, err := db.GetAlbumTracksDB(ctx, album.ID)
+	if err != nil {
+		t.Fatalf("GetAlbumTracksDB: %v", err)
+	}
+	want := []struct{ position, songID int }{{1, songs[0].ID}, {3, songs[2].ID}, {4, songs[3].ID}}
+	if len(tracks) != len(want) {
+		t.Fatalf("got %d tracks, want %d", len(tracks), len(want))
+	}
+	for i, track := range tracks {
+		if track.Position != want[i].position || track.Song.ID != want[i].songID {
+			t.Errorf("track %d: got position %d song %d, want position %d song %d",
+				i, track.Position, track.Song.ID, want[i].position, want[i].songID)
+		}
+	}
+}
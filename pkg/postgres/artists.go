@@ -0,0 +1,344 @@
+package postgres
+
+import (
+	"context"
+	"github.com/mao360/musicLib/models"
+	"github.com/mao360/musicLib/pkg/apperrors"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	artistAlreadyInDB = apperrors.New(apperrors.Conflict, "artist already in db")
+	artistNotFound    = apperrors.New(apperrors.NotFound, "artist not found")
+	artistHasSongs    = apperrors.New(apperrors.Conflict, "artist still has songs")
+	artistHasAlbums   = apperrors.New(apperrors.Conflict, "artist still has albums")
+)
+
+func (db *DB) GetArtistsDB(ctx context.Context, limit, offset int) ([]models.Artist, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	db.logger.Debugf("limit=%d offset=%d", limit, offset)
+	rows, err := db.conn.Query(ctx,
+		`SELECT id, name, created_at, updated_at
+	FROM artists
+	ORDER BY id
+	LIMIT $1 OFFSET $2;`, limit, offset)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "GetArtistsDB",
+			"subFunction": "Query()",
+		}).Errorf("error: %s", err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+	artists := make([]models.Artist, 0)
+	for rows.Next() {
+		artist := models.Artist{}
+		err = rows.Scan(&artist.ID, &artist.Name, &artist.CreatedAt, &artist.UpdatedAt)
+		if err != nil {
+			db.logger.WithFields(logrus.Fields{
+				"layer":       "db",
+				"function":    "GetArtistsDB",
+				"subFunction": "Scan()",
+			}).Errorf("error: %s", err.Error())
+			return nil, err
+		}
+		artists = append(artists, artist)
+	}
+	if err = rows.Err(); err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "GetArtistsDB",
+			"subFunction": "rows.Err()",
+		}).Errorf("error: %s", err.Error())
+		return nil, err
+	}
+	db.logger.Debugf("len of artists list=%d", len(artists))
+	return artists, nil
+}
+
+func (db *DB) CountArtistsDB(ctx context.Context) (int, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	var count int
+	err := db.conn.QueryRow(ctx,
+		`SELECT count(*) FROM artists;`).Scan(&count)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "CountArtistsDB",
+			"subFunction": "QueryRow()",
+		}).Errorf("error: %s", err.Error())
+		return 0, err
+	}
+	db.logger.Debugf("count=%d", count)
+	return count, nil
+}
+
+func (db *DB) SearchArtistByIDDB(ctx context.Context, id int) (models.Artist, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	db.logger.Debugf("search id=%d", id)
+	rows, err := db.conn.Query(ctx,
+		`SELECT id, name, created_at, updated_at
+	FROM artists
+	WHERE id=$1;`, id)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "SearchArtistByIDDB",
+			"subFunction": "Query()",
+		}).Errorf("error: %s", err.Error())
+		return models.Artist{}, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			db.logger.WithFields(logrus.Fields{
+				"layer":       "db",
+				"function":    "SearchArtistByIDDB",
+				"subFunction": "rows.Err()",
+			}).Errorf("error: %s", err.Error())
+			return models.Artist{}, err
+		}
+		db.logger.WithFields(logrus.Fields{
+			"layer":    "db",
+			"function": "SearchArtistByIDDB",
+		}).Errorf("error: %s", artistNotFound)
+		return models.Artist{}, artistNotFound
+	}
+	artist := models.Artist{}
+	err = rows.Scan(&artist.ID, &artist.Name, &artist.CreatedAt, &artist.UpdatedAt)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "SearchArtistByIDDB",
+			"subFunction": "Scan()",
+		}).Errorf("error: %s", err.Error())
+		return models.Artist{}, err
+	}
+	return artist, nil
+}
+
+func (db *DB) AddArtistDB(ctx context.Context, artist models.Artist) (models.Artist, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	db.logger.Debugf("adding artist name=%s", artist.Name)
+	if err := db.checkArtistNameFree(ctx, artist.Name, 0, "AddArtistDB"); err != nil {
+		return models.Artist{}, err
+	}
+	created := models.Artist{}
+	err := db.conn.QueryRow(ctx,
+		`INSERT INTO artists (name)
+	VALUES ($1)
+	RETURNING id, name, created_at, updated_at;`, artist.Name).
+		Scan(&created.ID, &created.Name, &created.CreatedAt, &created.UpdatedAt)
+	if isUniqueViolation(err) {
+		err = artistAlreadyInDB
+	}
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "AddArtistDB",
+			"subFunction": "QueryRow()",
+		}).Errorf("error: %s", err.Error())
+		return models.Artist{}, err
+	}
+	db.logger.Debugf("created artist id=%d", created.ID)
+	return created, nil
+}
+
+func (db *DB) RenameArtistByIDDB(ctx context.Context, id int, name string) (models.Artist, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	db.logger.Debugf("renaming artist id=%d to name=%s", id, name)
+	if err := db.checkArtistNameFree(ctx, name, id, "RenameArtistByIDDB"); err != nil {
+		return models.Artist{}, err
+	}
+	rows, err := db.conn.Query(ctx,
+		`UPDATE artists
+	SET name=$1,
+	    updated_at=now()
+	WHERE id=$2
+	RETURNING id, name, created_at, updated_at;`, name, id)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "RenameArtistByIDDB",
+			"subFunction": "Query()",
+		}).Errorf("error: %s", err.Error())
+		return models.Artist{}, err
+	}
+	defer rows.Close()
+	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			if isUniqueViolation(err) {
+				err = artistAlreadyInDB
+			}
+			db.logger.WithFields(logrus.Fields{
+				"layer":       "db",
+				"function":    "RenameArtistByIDDB",
+				"subFunction": "rows.Err()",
+			}).Errorf("error: %s", err.Error())
+			return models.Artist{}, err
+		}
+		db.logger.WithFields(logrus.Fields{
+			"layer":    "db",
+			"function": "RenameArtistByIDDB",
+		}).Errorf("error: %s", artistNotFound.Error())
+		return models.Artist{}, artistNotFound
+	}
+	renamed := models.Artist{}
+	err = rows.Scan(&renamed.ID, &renamed.Name, &renamed.CreatedAt, &renamed.UpdatedAt)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "RenameArtistByIDDB",
+			"subFunction": "Scan()",
+		}).Errorf("error: %s", err.Error())
+		return models.Artist{}, err
+	}
+	return renamed, nil
+}
+
+// DeleteArtistByIDDB removes an artist. Without cascade it refuses to delete
+// an artist that still has songs or albums, with cascade the songs and albums
+// are removed as well.
+func (db *DB) DeleteArtistByIDDB(ctx context.Context, id int, cascade bool) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	db.logger.Debugf("delete artist id=%d cascade=%t", id, cascade)
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "DeleteArtistByIDDB",
+			"subFunction": "Begin()",
+		}).Errorf("error: %s", err.Error())
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var songsCount, albumsCount int
+	err = tx.QueryRow(ctx,
+		`SELECT (SELECT count(*) FROM songs WHERE artist_id=$1),
+	       (SELECT count(*) FROM albums WHERE artist_id=$1);`, id).Scan(&songsCount, &albumsCount)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "DeleteArtistByIDDB",
+			"subFunction": "QueryRow()",
+		}).Errorf("error: %s", err.Error())
+		return err
+	}
+	db.logger.Debugf("songs of artist=%d albums of artist=%d", songsCount, albumsCount)
+	if !cascade {
+		switch {
+		case songsCount != 0:
+			db.logger.WithFields(logrus.Fields{
+				"layer":    "db",
+				"function": "DeleteArtistByIDDB",
+			}).Errorf("error: %s", artistHasSongs.Error())
+			return artistHasSongs
+		case albumsCount != 0:
+			db.logger.WithFields(logrus.Fields{
+				"layer":    "db",
+				"function": "DeleteArtistByIDDB",
+			}).Errorf("error: %s", artistHasAlbums.Error())
+			return artistHasAlbums
+		}
+	}
+	if albumsCount != 0 {
+		if _, err = tx.Exec(ctx,
+			`DELETE FROM album_tracks
+	WHERE album_id IN (SELECT id FROM albums WHERE artist_id=$1);`, id); err != nil {
+			db.logger.WithFields(logrus.Fields{
+				"layer":       "db",
+				"function":    "DeleteArtistByIDDB",
+				"subFunction": "Exec() album_tracks",
+			}).Errorf("error: %s", err.Error())
+			return err
+		}
+		if _, err = tx.Exec(ctx,
+			`DELETE FROM albums WHERE artist_id=$1;`, id); err != nil {
+			db.logger.WithFields(logrus.Fields{
+				"layer":       "db",
+				"function":    "DeleteArtistByIDDB",
+				"subFunction": "Exec() albums",
+			}).Errorf("error: %s", err.Error())
+			return err
+		}
+	}
+	if songsCount != 0 {
+		if _, err = tx.Exec(ctx,
+			`DELETE FROM songs WHERE artist_id=$1;`, id); err != nil {
+			db.logger.WithFields(logrus.Fields{
+				"layer":       "db",
+				"function":    "DeleteArtistByIDDB",
+				"subFunction": "Exec() songs",
+			}).Errorf("error: %s", err.Error())
+			return err
+		}
+	}
+
+	commandTag, err := tx.Exec(ctx,
+		`DELETE FROM artists WHERE id=$1;`, id)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "DeleteArtistByIDDB",
+			"subFunction": "Exec() artists",
+		}).Errorf("error: %s", err.Error())
+		return err
+	}
+	if commandTag.RowsAffected() != 1 {
+		db.logger.WithFields(logrus.Fields{
+			"layer":    "db",
+			"function": "DeleteArtistByIDDB",
+		}).Errorf("error: %s", artistNotFound.Error())
+		return artistNotFound
+	}
+	if err = tx.Commit(ctx); err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "DeleteArtistByIDDB",
+			"subFunction": "Commit()",
+		}).Errorf("error: %s", err.Error())
+		return err
+	}
+	return nil
+}
+
+// checkArtistNameFree fails if an artist other than the one with exceptID
+// has name. The unique index has the final say, a write racing another one
+// past this check maps its violation to the same error.
+func (db *DB) checkArtistNameFree(ctx context.Context, name string, exceptID int, function string) error {
+	rows, err := db.conn.Query(ctx,
+		`SELECT id FROM artists WHERE name=$1 AND id<>$2;`, name, exceptID)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    function,
+			"subFunction": "Query()",
+		}).Errorf("error: %s", err.Error())
+		return err
+	}
+	defer rows.Close()
+	if rows.Next() {
+		db.logger.WithFields(logrus.Fields{
+			"layer":    "db",
+			"function": function,
+		}).Errorf("error: %s", artistAlreadyInDB.Error())
+		return artistAlreadyInDB
+	}
+	if err = rows.Err(); err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    function,
+			"subFunction": "rows.Err()",
+		}).Errorf("error: %s", err.Error())
+		return err
+	}
+	return nil
+}
@@ -46,6 +46,16 @@ func ConnectToDB(url string, reload bool, logger *logrus.Logger) (*pgxpool.Pool,
 		logger.Fatalf("Error migration up %s", err)
 		return nil, err
 	}
+	var dateFailures int
+	err = pool.QueryRow(context.Background(),
+		`SELECT count(*) FROM release_date_failures;`).Scan(&dateFailures)
+	if err != nil {
+		logger.Fatalf("Error counting release_date_failures %s", err)
+		return nil, err
+	}
+	if dateFailures != 0 {
+		logger.Warnf("release_date: %d rows couldn't be parsed, see release_date_failures", dateFailures)
+	}
 	logger.Infof("Successful connection to db with all migrations")
 	return pool, nil
 }
@@ -0,0 +1,341 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/mao360/musicLib/models"
+	"github.com/mao360/musicLib/pkg/apperrors"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+var deadJobNotFound = apperrors.New(apperrors.NotFound, "dead enrichment job not found")
+
+const enrichmentJobColumns = `j.id, j.song_id, a.name, s.song_name, j.attempts, j.last_error, j.run_at, j.dead_at, j.created_at, j.updated_at`
+
+func enrichmentJobDest(job *models.EnrichmentJob) []interface{} {
+	return []interface{}{&job.ID, &job.SongID, &job.Group, &job.Song, &job.Attempts, &job.LastError,
+		&job.RunAt, &job.DeadAt, &job.CreatedAt, &job.UpdatedAt}
+}
+
+// ClaimEnrichmentJobDB takes the next due job off the queue and leases it
+// for lease, counting the attempt. A job whose lease ran out, its worker
+// gone, is due again. Jobs of trashed songs wait until the song is restored
+// or purged along with it. The bool is false when no job is due.
+func (db *DB) ClaimEnrichmentJobDB(ctx context.Context, lease time.Duration) (models.EnrichmentJob, bool, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	job := models.EnrichmentJob{}
+	err := db.conn.QueryRow(ctx,
+		`WITH due AS (
+	    SELECT id FROM enrichment_jobs
+	    WHERE dead_at IS NULL AND run_at <= now() AND (locked_until IS NULL OR locked_until < now())
+	      AND song_id IN (SELECT id FROM songs WHERE deleted_at IS NULL)
+	    ORDER BY run_at, id
+	    LIMIT 1
+	    FOR UPDATE SKIP LOCKED
+	), j AS (
+	    UPDATE enrichment_jobs
+	    SET attempts=attempts+1,
+	        locked_until=now() + make_interval(secs => $1),
+	        updated_at=now()
+	    WHERE id=(SELECT id FROM due)
+	    RETURNING *
+	)
+	SELECT `+enrichmentJobColumns+`
+	FROM j
+	JOIN songs s ON s.id = j.song_id
+	JOIN artists a ON a.id = s.artist_id;`, lease.Seconds()).Scan(enrichmentJobDest(&job)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.EnrichmentJob{}, false, nil
+	}
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "ClaimEnrichmentJobDB",
+			"subFunction": "QueryRow()",
+		}).Errorf("error: %s", err.Error())
+		return models.EnrichmentJob{}, false, err
+	}
+	db.logger.Debugf("claimed job id=%d song id=%d attempt=%d", job.ID, job.SongID, job.Attempts)
+	return job, true, nil
+}
+
+// CompleteEnrichmentJobDB fills the details of a pending song in from info
+// and removes its job. Fields set on the song in the meantime are kept. A song
+// moved to the trash meanwhile is left as it is and keeps its job.
+func (db *DB) CompleteEnrichmentJobDB(ctx context.Context, job models.EnrichmentJob, info models.Song) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	db.logger.Debugf("complete job id=%d song id=%d", job.ID, job.SongID)
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "CompleteEnrichmentJobDB",
+			"subFunction": "Begin()",
+		}).Errorf("error: %s", err.Error())
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	commandTag, err := tx.Exec(ctx,
+		`UPDATE songs
+	SET song_text=COALESCE(NULLIF(song_text, ''), $2),
+	    release_date=COALESCE(release_date, $3::date),
+	    link=COALESCE(NULLIF(link, ''), $4),
+	    status='ready',
+	    updated_at=now(),
+	    version=version+1
+	WHERE id=$1 AND status='pending' AND deleted_at IS NULL;`,
+		job.SongID, info.Text, releaseDateArg(info.ReleaseDate), info.Link)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "CompleteEnrichmentJobDB",
+			"subFunction": "Exec() song",
+		}).Errorf("error: %s", err.Error())
+		return err
+	}
+	if commandTag.RowsAffected() == 1 {
+		if err = db.addRevisions(ctx, tx, "CompleteEnrichmentJobDB", job.SongID); err != nil {
+			return err
+		}
+	}
+	if _, err = tx.Exec(ctx,
+		`DELETE FROM enrichment_jobs
+	WHERE id=$1 AND NOT EXISTS (
+	    SELECT 1 FROM songs WHERE id=$2 AND status='pending' AND deleted_at IS NOT NULL
+	);`, job.ID, job.SongID); err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "CompleteEnrichmentJobDB",
+			"subFunction": "Exec() job",
+		}).Errorf("error: %s", err.Error())
+		return err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "CompleteEnrichmentJobDB",
+			"subFunction": "Commit()",
+		}).Errorf("error: %s", err.Error())
+		return err
+	}
+	return nil
+}
+
+// RetryEnrichmentJobDB releases a failed job to be claimed again at runAt.
+func (db *DB) RetryEnrichmentJobDB(ctx context.Context, job models.EnrichmentJob, runAt time.Time, lastError string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	db.logger.Debugf("retry job id=%d at %s", job.ID, runAt)
+	_, err := db.conn.Exec(ctx,
+		`UPDATE enrichment_jobs
+	SET run_at=$2,
+	    locked_until=NULL,
+	    last_error=$3,
+	    updated_at=now()
+	WHERE id=$1;`, job.ID, runAt, lastError)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "RetryEnrichmentJobDB",
+			"subFunction": "Exec()",
+		}).Errorf("error: %s", err.Error())
+		return err
+	}
+	return nil
+}
+
+// DeadLetterEnrichmentJobDB parks a job that failed for good and marks its
+// song failed.
+func (db *DB) DeadLetterEnrichmentJobDB(ctx context.Context, job models.EnrichmentJob, lastError string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	db.logger.Debugf("dead letter job id=%d", job.ID)
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "DeadLetterEnrichmentJobDB",
+			"subFunction": "Begin()",
+		}).Errorf("error: %s", err.Error())
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err = tx.Exec(ctx,
+		`UPDATE enrichment_jobs
+	SET dead_at=now(),
+	    locked_until=NULL,
+	    last_error=$2,
+	    updated_at=now()
+	WHERE id=$1;`, job.ID, lastError); err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "DeadLetterEnrichmentJobDB",
+			"subFunction": "Exec() job",
+		}).Errorf("error: %s", err.Error())
+		return err
+	}
+	if _, err = tx.Exec(ctx,
+		`UPDATE songs
+	SET status='failed',
+	    updated_at=now(),
+	    version=version+1
+	WHERE id=$1 AND status='pending' AND deleted_at IS NULL;`, job.SongID); err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "DeadLetterEnrichmentJobDB",
+			"subFunction": "Exec() song",
+		}).Errorf("error: %s", err.Error())
+		return err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "DeadLetterEnrichmentJobDB",
+			"subFunction": "Commit()",
+		}).Errorf("error: %s", err.Error())
+		return err
+	}
+	return nil
+}
+
+// GetDeadEnrichmentJobsDB lists the dead letters, the latest failed first.
+func (db *DB) GetDeadEnrichmentJobsDB(ctx context.Context, limit, offset int) ([]models.EnrichmentJob, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	db.logger.Debugf("limit=%d offset=%d", limit, offset)
+	rows, err := db.conn.Query(ctx,
+		`SELECT `+enrichmentJobColumns+`
+	FROM enrichment_jobs j
+	JOIN songs s ON s.id = j.song_id
+	JOIN artists a ON a.id = s.artist_id
+	WHERE j.dead_at IS NOT NULL
+	ORDER BY j.dead_at DESC, j.id
+	LIMIT $1 OFFSET $2;`, limit, offset)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "GetDeadEnrichmentJobsDB",
+			"subFunction": "Query()",
+		}).Errorf("error: %s", err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+	jobs := make([]models.EnrichmentJob, 0)
+	for rows.Next() {
+		job := models.EnrichmentJob{}
+		if err = rows.Scan(enrichmentJobDest(&job)...); err != nil {
+			db.logger.WithFields(logrus.Fields{
+				"layer":       "db",
+				"function":    "GetDeadEnrichmentJobsDB",
+				"subFunction": "Scan()",
+			}).Errorf("error: %s", err.Error())
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	if err = rows.Err(); err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "GetDeadEnrichmentJobsDB",
+			"subFunction": "rows.Err()",
+		}).Errorf("error: %s", err.Error())
+		return nil, err
+	}
+	db.logger.Debugf("len of dead jobs list=%d", len(jobs))
+	return jobs, nil
+}
+
+func (db *DB) CountDeadEnrichmentJobsDB(ctx context.Context) (int, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	var count int
+	err := db.conn.QueryRow(ctx,
+		`SELECT count(*) FROM enrichment_jobs WHERE dead_at IS NOT NULL;`).Scan(&count)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "CountDeadEnrichmentJobsDB",
+			"subFunction": "QueryRow()",
+		}).Errorf("error: %s", err.Error())
+		return 0, err
+	}
+	db.logger.Debugf("count=%d", count)
+	return count, nil
+}
+
+// RequeueEnrichmentJobDB puts a dead letter back on the queue with its
+// attempts reset and its song pending again.
+func (db *DB) RequeueEnrichmentJobDB(ctx context.Context, id int) (models.EnrichmentJob, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	db.logger.Debugf("requeue job id=%d", id)
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "RequeueEnrichmentJobDB",
+			"subFunction": "Begin()",
+		}).Errorf("error: %s", err.Error())
+		return models.EnrichmentJob{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	job := models.EnrichmentJob{}
+	err = tx.QueryRow(ctx,
+		`WITH j AS (
+	    UPDATE enrichment_jobs
+	    SET dead_at=NULL,
+	        attempts=0,
+	        run_at=now(),
+	        updated_at=now()
+	    WHERE id=$1 AND dead_at IS NOT NULL
+	    RETURNING *
+	)
+	SELECT `+enrichmentJobColumns+`
+	FROM j
+	JOIN songs s ON s.id = j.song_id
+	JOIN artists a ON a.id = s.artist_id;`, id).Scan(enrichmentJobDest(&job)...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		db.logger.WithFields(logrus.Fields{
+			"layer":    "db",
+			"function": "RequeueEnrichmentJobDB",
+		}).Errorf("error: %s", deadJobNotFound.Error())
+		return models.EnrichmentJob{}, deadJobNotFound
+	}
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "RequeueEnrichmentJobDB",
+			"subFunction": "QueryRow() job",
+		}).Errorf("error: %s", err.Error())
+		return models.EnrichmentJob{}, err
+	}
+	if _, err = tx.Exec(ctx,
+		`UPDATE songs
+	SET status='pending',
+	    updated_at=now(),
+	    version=version+1
+	WHERE id=$1 AND status='failed';`, job.SongID); err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "RequeueEnrichmentJobDB",
+			"subFunction": "Exec() song",
+		}).Errorf("error: %s", err.Error())
+		return models.EnrichmentJob{}, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "RequeueEnrichmentJobDB",
+			"subFunction": "Commit()",
+		}).Errorf("error: %s", err.Error())
+		return models.EnrichmentJob{}, err
+	}
+	return job, nil
+}
@@ -0,0 +1,71 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"github.com/mao360/musicLib/models"
+	"github.com/sirupsen/logrus"
+	"strings"
+)
+
+// ExportSongsDB calls fn for every song matching the filters in the order of
+// GetSongsByFilterDB, without a limit. pgx reads the rows off the connection
+// one at a time, so only the current song is held in memory. An error from fn
+// stops the export and is returned. The export streams for as long as the
+// catalogue takes, it is bounded by ctx only and not by the query timeout.
+func (db *DB) ExportSongsDB(ctx context.Context, filters, matches map[string]string, sort []models.SortField, fn func(models.Song) error) error {
+	db.logger.Debugf("len(filters)=%d matches=%v sort=%v", len(filters), matches, sort)
+	query := songsSelect
+	conditions, values, similarities := songsFilter(filters, matches)
+	if len(conditions) != 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	if len(sort) == 0 && len(similarities) != 0 {
+		query += fmt.Sprintf(" ORDER BY %s DESC, s.id;", strings.Join(similarities, " + "))
+	} else {
+		query += " ORDER BY " + songsOrderBy(SongsOrder(sort), false) + ";"
+	}
+
+	db.logger.Debugf("SQL query: %s", query)
+	rows, err := db.conn.Query(ctx, query, values...)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "ExportSongsDB",
+			"subFunction": "Query()",
+		}).Errorf("error: %s", err.Error())
+		return err
+	}
+	defer rows.Close()
+	exported := 0
+	for rows.Next() {
+		row := songRow{}
+		if err = rows.Scan(row.dest()...); err != nil {
+			db.logger.WithFields(logrus.Fields{
+				"layer":       "db",
+				"function":    "ExportSongsDB",
+				"subFunction": "Scan()",
+			}).Errorf("error: %s", err.Error())
+			return err
+		}
+		if err = fn(row.result()); err != nil {
+			db.logger.WithFields(logrus.Fields{
+				"layer":       "db",
+				"function":    "ExportSongsDB",
+				"subFunction": "fn()",
+			}).Errorf("error: %s", err.Error())
+			return err
+		}
+		exported++
+	}
+	if err = rows.Err(); err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "ExportSongsDB",
+			"subFunction": "rows.Err()",
+		}).Errorf("error: %s", err.Error())
+		return err
+	}
+	db.logger.Debugf("exported songs=%d", exported)
+	return nil
+}
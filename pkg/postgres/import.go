@@ -0,0 +1,166 @@
+package postgres
+
+import (
+	"context"
+	"github.com/jackc/pgx/v5"
+	"github.com/mao360/musicLib/models"
+	"github.com/sirupsen/logrus"
+)
+
+// ImportSongsDB inserts a batch of songs keyed by their row number in the
+// imported file. The batch is copied into a temporary table, then every song
+// that isn't in the library yet (by group and song name) is inserted. The
+// first row wins when the batch itself repeats a song. It returns the ids of
+// the created songs by row number and the ids of the trashed songs that rows
+// repeat, as with AddSongDB those have to be restored instead. Rows missing
+// from both were duplicates of songs in the library.
+func (db *DB) ImportSongsDB(ctx context.Context, batch map[int]models.Song) (created, trashed map[int]int, err error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	db.logger.Debugf("import batch len=%d", len(batch))
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "ImportSongsDB",
+			"subFunction": "Begin()",
+		}).Errorf("error: %s", err.Error())
+		return nil, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err = tx.Exec(ctx,
+		`CREATE TEMP TABLE import_songs (
+    row_num INT,
+    group_name VARCHAR(255),
+    song_name VARCHAR(255),
+    song_text TEXT,
+    release_date DATE,
+    link VARCHAR(255)
+	) ON COMMIT DROP;`); err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "ImportSongsDB",
+			"subFunction": "Exec() create",
+		}).Errorf("error: %s", err.Error())
+		return nil, nil, err
+	}
+
+	rows := make([][]interface{}, 0, len(batch))
+	for rowNum, song := range batch {
+		rows = append(rows, []interface{}{rowNum, song.Group, song.Song, song.Text, releaseDateArg(song.ReleaseDate), song.Link})
+	}
+	copied, err := tx.CopyFrom(ctx,
+		pgx.Identifier{"import_songs"},
+		[]string{"row_num", "group_name", "song_name", "song_text", "release_date", "link"},
+		pgx.CopyFromRows(rows))
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "ImportSongsDB",
+			"subFunction": "CopyFrom()",
+		}).Errorf("error: %s", err.Error())
+		return nil, nil, err
+	}
+	db.logger.Debugf("copied rows=%d", copied)
+
+	if _, err = tx.Exec(ctx,
+		`INSERT INTO artists (name)
+	SELECT DISTINCT group_name FROM import_songs
+	ON CONFLICT (name) DO NOTHING;`); err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "ImportSongsDB",
+			"subFunction": "Exec() artists",
+		}).Errorf("error: %s", err.Error())
+		return nil, nil, err
+	}
+
+	// Trashed songs count as in the library, as in addSong.
+	trashed, err = db.importedIDs(ctx, tx,
+		`SELECT i.row_num, s.id
+	FROM import_songs i
+	JOIN artists a ON a.name = i.group_name
+	JOIN songs s ON s.artist_id = a.id AND s.song_name = i.song_name
+	WHERE s.deleted_at IS NOT NULL;`, "trashed")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	created, err = db.importedIDs(ctx, tx,
+		`WITH candidates AS (
+	    SELECT DISTINCT ON (a.id, i.song_name) i.row_num, a.id AS artist_id, i.song_name, i.song_text, i.release_date, i.link
+	    FROM import_songs i
+	    JOIN artists a ON a.name = i.group_name
+	    WHERE NOT EXISTS (
+	        SELECT 1 FROM songs s WHERE s.artist_id = a.id AND s.song_name = i.song_name
+	    )
+	    ORDER BY a.id, i.song_name, i.row_num
+	), inserted AS (
+	    INSERT INTO songs (artist_id, song_name, song_text, release_date, link)
+	    SELECT artist_id, song_name, song_text, release_date, link FROM candidates
+	    RETURNING id, artist_id, song_name
+	)
+	SELECT c.row_num, ins.id
+	FROM candidates c
+	JOIN inserted ins ON ins.artist_id = c.artist_id AND ins.song_name = c.song_name;`, "insert")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	ids := make([]int, 0, len(created))
+	for _, id := range created {
+		ids = append(ids, id)
+	}
+	if err = db.addRevisions(ctx, tx, "ImportSongsDB", ids...); err != nil {
+		return nil, nil, err
+	}
+
+	if err = tx.Commit(ctx); err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "ImportSongsDB",
+			"subFunction": "Commit()",
+		}).Errorf("error: %s", err.Error())
+		return nil, nil, err
+	}
+	db.logger.Debugf("created songs=%d trashed songs=%d", len(created), len(trashed))
+	return created, trashed, nil
+}
+
+// importedIDs runs a query of row numbers and song ids over the import_songs
+// table.
+func (db *DB) importedIDs(ctx context.Context, tx pgx.Tx, query, name string) (map[int]int, error) {
+	result, err := tx.Query(ctx, query)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "ImportSongsDB",
+			"subFunction": "Query() " + name,
+		}).Errorf("error: %s", err.Error())
+		return nil, err
+	}
+	defer result.Close()
+	ids := make(map[int]int)
+	for result.Next() {
+		var rowNum, id int
+		if err = result.Scan(&rowNum, &id); err != nil {
+			db.logger.WithFields(logrus.Fields{
+				"layer":       "db",
+				"function":    "ImportSongsDB",
+				"subFunction": "Scan() " + name,
+			}).Errorf("error: %s", err.Error())
+			return nil, err
+		}
+		ids[rowNum] = id
+	}
+	if err = result.Err(); err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "ImportSongsDB",
+			"subFunction": "rows.Err() " + name,
+		}).Errorf("error: %s", err.Error())
+		return nil, err
+	}
+	return ids, nil
+}
@@ -4,60 +4,240 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/mao360/musicLib/models"
+	"github.com/mao360/musicLib/pkg/apperrors"
 	"github.com/sirupsen/logrus"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 )
 
 var (
-	songAlreadyInDB = errors.New("song already in db")
-	songNotFound    = errors.New("song not found")
-	changedColumns  = errors.New("unexpected number of changed columns")
+	songAlreadyInDB   = apperrors.New(apperrors.Conflict, "song already in db")
+	songNotFound      = apperrors.New(apperrors.NotFound, "song not found")
+	invalidCursorKeys = apperrors.New(apperrors.Validation, "cursor keys don't match sort")
+	// ErrVersionMismatch means the song was changed since the version the
+	// caller based its change on.
+	ErrVersionMismatch = apperrors.New(apperrors.Precondition, "song version mismatch")
+	// ErrSongInTrash means the song being added, or the group and song name
+	// a song is changed to, is in the trash and has to be restored instead.
+	ErrSongInTrash = apperrors.New(apperrors.Conflict, "song is in the trash, restore it instead")
 )
 
+const songsSelect = `SELECT s.id, s.artist_id, a.name, s.song_name, s.song_text, s.release_date, s.link, s.created_at, s.updated_at, s.version, s.status
+	FROM songs s
+	JOIN artists a ON a.id = s.artist_id`
+
+// ReleaseDateLayout is the format release dates have in the API, the column
+// itself is a DATE.
+const ReleaseDateLayout = "02.01.2006"
+
+// songRow is the scan target of songsSelect columns.
+type songRow struct {
+	song        models.Song
+	releaseDate *time.Time
+}
+
+func (r *songRow) dest() []interface{} {
+	return []interface{}{&r.song.ID, &r.song.ArtistID, &r.song.Group, &r.song.Song, &r.song.Text,
+		&r.releaseDate, &r.song.Link, &r.song.CreatedAt, &r.song.UpdatedAt, &r.song.Version, &r.song.Status}
+}
+
+func (r *songRow) result() models.Song {
+	r.song.ReleaseDate = ""
+	if r.releaseDate != nil {
+		r.song.ReleaseDate = r.releaseDate.Format(ReleaseDateLayout)
+	}
+	return r.song
+}
+
+// releaseDateArg converts an API release date to the value written to the
+// DATE column, empty or malformed dates are stored as NULL.
+func releaseDateArg(date string) *time.Time {
+	parsed, err := time.Parse(ReleaseDateLayout, date)
+	if err != nil {
+		return nil
+	}
+	return &parsed
+}
+
+var filterColumns = map[string]string{
+	"group_name":      "a.name",
+	"song_name":       "s.song_name",
+	"song_text":       "s.song_text",
+	"release_date":    "s.release_date",
+	"year":            "s.release_date",
+	"decade":          "s.release_date",
+	"released_after":  "s.release_date",
+	"released_before": "s.release_date",
+	"link":            "s.link",
+	"artist_id":       "s.artist_id",
+	"album_id":        "s.id",
+}
+
+// Match modes of the group_name and song_name filters.
+const (
+	MatchExact    = "exact"
+	MatchContains = "contains"
+	MatchFuzzy    = "fuzzy"
+)
+
+// sortColumns maps sortable fields to their SQL expressions. Songs without a
+// release date sort as the earliest ones.
+var sortColumns = map[string]string{
+	"id":           "s.id",
+	"group_name":   "a.name",
+	"song_name":    "s.song_name",
+	"release_date": "COALESCE(s.release_date, '-infinity')",
+	"link":         "s.link",
+	"created_at":   "s.created_at",
+	"updated_at":   "s.updated_at",
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
 type DBInterface interface {
-	GetSongsByFilterDB(filters map[string]string, limit, offset int) ([]models.Song, error)
-	SearchSongByIDDB(id int) (models.Song, error)
-	DeleteSongByIDDB(id int) error
-	ChangeSongByIDDB(id int, song models.Song) error
-	AddSongDB(song models.Song) error
+	GetSongsByFilterDB(ctx context.Context, filters, matches map[string]string, sort []models.SortField, limit, offset int, cursor *models.Cursor) ([]models.Song, error)
+	ExportSongsDB(ctx context.Context, filters, matches map[string]string, sort []models.SortField, fn func(models.Song) error) error
+	CountSongsByFilterDB(ctx context.Context, filters, matches map[string]string) (int, error)
+	SearchSongByIDDB(ctx context.Context, id int) (models.Song, error)
+	DeleteSongByIDDB(ctx context.Context, id, version int) error
+	ChangeSongByIDDB(ctx context.Context, id, version int, song models.Song) (models.Song, error)
+	PatchSongByIDDB(ctx context.Context, id, version int, patch map[string]*string) (models.Song, error)
+	AddSongDB(ctx context.Context, song models.Song) (models.Song, error)
+	AddPendingSongDB(ctx context.Context, song models.Song) (models.Song, error)
+	ImportSongsDB(ctx context.Context, batch map[int]models.Song) (created, trashed map[int]int, err error)
+	GetSongRevisionsDB(ctx context.Context, songID int) ([]models.SongRevision, error)
+	GetSongRevisionDB(ctx context.Context, songID, revision int) (models.SongRevision, error)
+	GetTrashDB(ctx context.Context, limit, offset int) ([]models.TrashedSong, error)
+	CountTrashDB(ctx context.Context) (int, error)
+	RestoreSongByIDDB(ctx context.Context, id int) (models.Song, error)
+	PurgeSongByIDDB(ctx context.Context, id int) error
+	PurgeTrashDB(ctx context.Context, deletedBefore time.Time) (int64, error)
+
+	ClaimEnrichmentJobDB(ctx context.Context, lease time.Duration) (models.EnrichmentJob, bool, error)
+	CompleteEnrichmentJobDB(ctx context.Context, job models.EnrichmentJob, info models.Song) error
+	RetryEnrichmentJobDB(ctx context.Context, job models.EnrichmentJob, runAt time.Time, lastError string) error
+	DeadLetterEnrichmentJobDB(ctx context.Context, job models.EnrichmentJob, lastError string) error
+	GetDeadEnrichmentJobsDB(ctx context.Context, limit, offset int) ([]models.EnrichmentJob, error)
+	CountDeadEnrichmentJobsDB(ctx context.Context) (int, error)
+	RequeueEnrichmentJobDB(ctx context.Context, id int) (models.EnrichmentJob, error)
+
+	GetArtistsDB(ctx context.Context, limit, offset int) ([]models.Artist, error)
+	CountArtistsDB(ctx context.Context) (int, error)
+	SearchArtistByIDDB(ctx context.Context, id int) (models.Artist, error)
+	AddArtistDB(ctx context.Context, artist models.Artist) (models.Artist, error)
+	RenameArtistByIDDB(ctx context.Context, id int, name string) (models.Artist, error)
+	DeleteArtistByIDDB(ctx context.Context, id int, cascade bool) error
+
+	SearchAlbumByIDDB(ctx context.Context, id int) (models.Album, error)
+	AddAlbumDB(ctx context.Context, album models.Album) (models.Album, error)
+	GetAlbumTracksDB(ctx context.Context, albumID int) ([]models.Track, error)
+	AttachTrackDB(ctx context.Context, albumID int, track models.TrackAttach) error
+	ReorderTracksDB(ctx context.Context, albumID int, songIDs []int) error
+
+	SearchSongsDB(ctx context.Context, query, config string, limit, offset int) ([]models.SearchResult, error)
+	CountSearchSongsDB(ctx context.Context, query, config string) (int, error)
 }
 
 type DB struct {
-	conn   *pgxpool.Pool
-	logger *logrus.Logger
+	conn         *pgxpool.Pool
+	logger       *logrus.Logger
+	queryTimeout time.Duration
 }
 
-func NewDB(conn *pgxpool.Pool, logger *logrus.Logger) *DB {
-	return &DB{conn, logger}
+// NewDB returns the repository over conn. A positive queryTimeout bounds each
+// call of the repository on top of the deadline of the context passed in.
+func NewDB(conn *pgxpool.Pool, logger *logrus.Logger, queryTimeout time.Duration) *DB {
+	return &DB{conn, logger, queryTimeout}
 }
 
-func (db *DB) GetSongsByFilterDB(filters map[string]string, limit, offset int) ([]models.Song, error) {
-	db.logger.Debugf("len(filters)=%d limit=%d offset=%d", len(filters), limit, offset)
-	query := "SELECT group_name, song_name, song_text, release_date, link FROM songs"
-	values := make([]interface{}, 0)
-	placeholderNum := 1
-	if len(filters) != 0 {
-		query += ` WHERE `
-		for k, v := range filters {
-			if k == "release_date" {
-				query += fmt.Sprintf("%s LIKE '%%%s' AND ", k, v)
-				continue
-			} else {
-				query += fmt.Sprintf("%s=$%d AND ", k, placeholderNum)
+// isUniqueViolation reports whether err is postgres refusing a write that
+// breaks a unique constraint, a check-then-write race lost to another call.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// withTimeout derives the context of a single repository call from ctx.
+// pgx cancels the running query on the server once the context is done.
+func (db *DB) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if db.queryTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, db.queryTimeout)
+}
+
+// GetSongsByFilterDB returns a page of songs matching filters. matches holds
+// the match mode of a filter by its key, filters without a mode are compared
+// exactly. The songs are ordered by sort, then by id; without sort fuzzy
+// matches are ordered by their trigram similarity.
+//
+// With a nil cursor the page is taken by limit and offset. Otherwise offset is
+// ignored and the page is the limit songs following (or, for a backward
+// cursor, preceding) the cursor keys in SongsOrder(sort).
+func (db *DB) GetSongsByFilterDB(ctx context.Context, filters, matches map[string]string, sort []models.SortField, limit, offset int, cursor *models.Cursor) ([]models.Song, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	db.logger.Debugf("len(filters)=%d matches=%v sort=%v limit=%d offset=%d cursor=%v", len(filters), matches, sort, limit, offset, cursor)
+	query := songsSelect
+	conditions, values, similarities := songsFilter(filters, matches)
+	placeholderNum := len(values) + 1
+	order := SongsOrder(sort)
+	backward := cursor != nil && cursor.Backward
+	if cursor != nil && len(cursor.Keys) != 0 {
+		if len(cursor.Keys) != len(order) {
+			db.logger.WithFields(logrus.Fields{
+				"layer":    "db",
+				"function": "GetSongsByFilterDB",
+			}).Errorf("error: %s", invalidCursorKeys.Error())
+			return nil, invalidCursorKeys
+		}
+		// (k1 > v1) OR (k1 = v1 AND k2 > v2) OR ..., with > turned into <
+		// for descending keys and flipped once more when paging backward.
+		alternatives := make([]string, 0, len(order))
+		for i, field := range order {
+			equals := make([]string, 0, i+1)
+			for j := 0; j < i; j++ {
+				equals = append(equals, fmt.Sprintf("%s = $%d", sortColumns[order[j].Field], placeholderNum+j))
 			}
-			placeholderNum++
-			values = append(values, v)
+			operator := ">"
+			if field.Desc != backward {
+				operator = "<"
+			}
+			equals = append(equals, fmt.Sprintf("%s %s $%d", sortColumns[field.Field], operator, placeholderNum+i))
+			alternatives = append(alternatives, "("+strings.Join(equals, " AND ")+")")
+		}
+		conditions = append(conditions, "("+strings.Join(alternatives, " OR ")+")")
+		placeholderNum += len(order)
+		for _, key := range cursor.Keys {
+			values = append(values, key)
 		}
-		query = strings.TrimSuffix(query, " AND ")
+	}
+	if len(conditions) != 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
 	}
 
-	query += fmt.Sprintf(" LIMIT $%d OFFSET $%d;", placeholderNum, placeholderNum+1)
-	values = append(values, limit, offset)
+	if len(sort) == 0 && len(similarities) != 0 && cursor == nil {
+		query += fmt.Sprintf(" ORDER BY %s DESC, s.id", strings.Join(similarities, " + "))
+	} else {
+		query += " ORDER BY " + songsOrderBy(order, backward)
+	}
+
+	if cursor != nil {
+		query += fmt.Sprintf(" LIMIT $%d;", placeholderNum)
+		values = append(values, limit)
+	} else {
+		query += fmt.Sprintf(" LIMIT $%d OFFSET $%d;", placeholderNum, placeholderNum+1)
+		values = append(values, limit, offset)
+	}
 
 	db.logger.Debugf("SQL query: %s", query)
-	rows, err := db.conn.Query(context.Background(), query, values...)
+	rows, err := db.conn.Query(ctx, query, values...)
 
 	defer rows.Close()
 	if err != nil {
@@ -70,8 +250,8 @@ func (db *DB) GetSongsByFilterDB(filters map[string]string, limit, offset int) (
 	}
 	songs := make([]models.Song, 0)
 	for rows.Next() {
-		song := models.Song{}
-		err = rows.Scan(&song.Group, &song.Song, &song.Text, &song.ReleaseDate, &song.Link)
+		row := songRow{}
+		err = rows.Scan(row.dest()...)
 		if err != nil {
 			db.logger.WithFields(logrus.Fields{
 				"layer":       "db",
@@ -80,18 +260,159 @@ func (db *DB) GetSongsByFilterDB(filters map[string]string, limit, offset int) (
 			}).Errorf("error: %s", err.Error())
 			return nil, err
 		}
-		songs = append(songs, song)
+		songs = append(songs, row.result())
+	}
+	if err = rows.Err(); err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "GetSongsByFilterDB",
+			"subFunction": "rows.Err()",
+		}).Errorf("error: %s", err.Error())
+		return nil, err
+	}
+	if backward {
+		slices.Reverse(songs)
 	}
 	db.logger.Debugf("len of songs list=%d", len(songs))
 	return songs, nil
 }
 
-func (db *DB) SearchSongByIDDB(id int) (models.Song, error) {
+// songsOrderBy turns the full ordering into ORDER BY columns, reversed when
+// paging backward.
+func songsOrderBy(order []models.SortField, backward bool) string {
+	columns := make([]string, 0, len(order))
+	for _, field := range order {
+		if field.Desc != backward {
+			columns = append(columns, sortColumns[field.Field]+" DESC")
+		} else {
+			columns = append(columns, sortColumns[field.Field])
+		}
+	}
+	return strings.Join(columns, ", ")
+}
+
+// SongsOrder is the full ordering of a songs query: the sort fields followed
+// by id as a tiebreaker, unless sort already has it. Fields missing from
+// sortColumns are dropped.
+func SongsOrder(sort []models.SortField) []models.SortField {
+	order := make([]models.SortField, 0, len(sort)+1)
+	hasID := false
+	for _, field := range sort {
+		if _, ok := sortColumns[field.Field]; !ok {
+			continue
+		}
+		hasID = hasID || field.Field == "id"
+		order = append(order, field)
+	}
+	if !hasID {
+		order = append(order, models.SortField{Field: "id"})
+	}
+	return order
+}
+
+// SortKey returns the value song has for a sort field, in the form its
+// sortColumns expression is compared with.
+func SortKey(song models.Song, field string) string {
+	switch field {
+	case "group_name":
+		return song.Group
+	case "song_name":
+		return song.Song
+	case "release_date":
+		date := releaseDateArg(song.ReleaseDate)
+		if date == nil {
+			return "-infinity"
+		}
+		return date.Format(time.DateOnly)
+	case "link":
+		return song.Link
+	case "created_at":
+		return song.CreatedAt.Format(time.RFC3339Nano)
+	case "updated_at":
+		return song.UpdatedAt.Format(time.RFC3339Nano)
+	default:
+		return strconv.Itoa(song.ID)
+	}
+}
+
+// songsFilter builds the WHERE conditions of a songs query over songsSelect
+// together with their placeholder values, which are numbered from $1. Songs in
+// the trash are always left out. The similarity expressions of fuzzy matches
+// are returned for ordering.
+func songsFilter(filters, matches map[string]string) ([]string, []interface{}, []string) {
+	values := make([]interface{}, 0)
+	conditions := []string{"s.deleted_at IS NULL"}
+	similarities := make([]string, 0)
+	placeholderNum := 1
+	for k, v := range filters {
+		column, ok := filterColumns[k]
+		if !ok {
+			continue
+		}
+		var date *time.Time
+		if k == "release_date" || k == "year" {
+			conditions = append(conditions, fmt.Sprintf("%s >= make_date($%d, 1, 1) AND %s < make_date($%d + 1, 1, 1)", column, placeholderNum, column, placeholderNum))
+		} else if k == "decade" {
+			conditions = append(conditions, fmt.Sprintf("%s >= make_date($%d, 1, 1) AND %s < make_date($%d + 10, 1, 1)", column, placeholderNum, column, placeholderNum))
+		} else if k == "released_after" {
+			conditions = append(conditions, fmt.Sprintf("%s >= $%d", column, placeholderNum))
+			date = releaseDateArg(v)
+		} else if k == "released_before" {
+			conditions = append(conditions, fmt.Sprintf("%s <= $%d", column, placeholderNum))
+			date = releaseDateArg(v)
+		} else if k == "album_id" {
+			conditions = append(conditions, fmt.Sprintf("%s IN (SELECT song_id FROM album_tracks WHERE album_id=$%d)", column, placeholderNum))
+		} else if matches[k] == MatchContains {
+			conditions = append(conditions, fmt.Sprintf("%s ILIKE '%%' || $%d || '%%'", column, placeholderNum))
+			v = likeEscaper.Replace(v)
+		} else if matches[k] == MatchFuzzy {
+			conditions = append(conditions, fmt.Sprintf("%s %% $%d", column, placeholderNum))
+			similarities = append(similarities, fmt.Sprintf("similarity(%s, $%d)", column, placeholderNum))
+		} else {
+			conditions = append(conditions, fmt.Sprintf("%s=$%d", column, placeholderNum))
+		}
+		placeholderNum++
+		if date != nil {
+			values = append(values, date)
+		} else {
+			values = append(values, v)
+		}
+	}
+	return conditions, values, similarities
+}
+
+func (db *DB) CountSongsByFilterDB(ctx context.Context, filters, matches map[string]string) (int, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	db.logger.Debugf("len(filters)=%d matches=%v", len(filters), matches)
+	query := `SELECT count(*)
+	FROM songs s
+	JOIN artists a ON a.id = s.artist_id`
+	conditions, values, _ := songsFilter(filters, matches)
+	if len(conditions) != 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	db.logger.Debugf("SQL query: %s", query)
+	var count int
+	if err := db.conn.QueryRow(ctx, query, values...).Scan(&count); err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "CountSongsByFilterDB",
+			"subFunction": "QueryRow()",
+		}).Errorf("error: %s", err.Error())
+		return 0, err
+	}
+	db.logger.Debugf("count=%d", count)
+	return count, nil
+}
+
+func (db *DB) SearchSongByIDDB(ctx context.Context, id int) (models.Song, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
 	db.logger.Debugf("search id=%d", id)
-	rows, err := db.conn.Query(context.Background(),
-		`SELECT group_name, song_name, song_text, release_date, link
-	FROM songs
-	WHERE id=$1;`, id)
+	rows, err := db.conn.Query(ctx,
+		songsSelect+`
+	WHERE s.id=$1 AND s.deleted_at IS NULL;`, id)
 	defer rows.Close()
 	if err != nil {
 		db.logger.WithFields(logrus.Fields{
@@ -102,14 +423,22 @@ func (db *DB) SearchSongByIDDB(id int) (models.Song, error) {
 		return models.Song{}, err
 	}
 	if !rows.Next() {
+		if err = rows.Err(); err != nil {
+			db.logger.WithFields(logrus.Fields{
+				"layer":       "db",
+				"function":    "SearchSongByIDDB",
+				"subFunction": "rows.Err()",
+			}).Errorf("error: %s", err.Error())
+			return models.Song{}, err
+		}
 		db.logger.WithFields(logrus.Fields{
 			"layer":    "db",
 			"function": "SearchSongByIDDB",
 		}).Errorf("error: %s", songNotFound)
 		return models.Song{}, songNotFound
 	}
-	song := models.Song{}
-	err = rows.Scan(&song.Group, &song.Song, &song.Text, &song.ReleaseDate, &song.Link)
+	row := songRow{}
+	err = rows.Scan(row.dest()...)
 	if err != nil {
 		db.logger.WithFields(logrus.Fields{
 			"layer":       "db",
@@ -118,132 +447,374 @@ func (db *DB) SearchSongByIDDB(id int) (models.Song, error) {
 		}).Errorf("error: %s", err.Error())
 		return models.Song{}, err
 	}
+	song := row.result()
 	db.logger.Debugf("searched song: %s %s %s", song.Group, song.Song, song.Text)
 	return song, nil
 }
 
-func (db *DB) DeleteSongByIDDB(id int) error {
-	db.logger.Debugf("searched id=%d", id)
-	rows, err := db.conn.Query(context.Background(),
-		`SELECT id FROM songs WHERE id=$1;`, id)
+// DeleteSongByIDDB moves the song to the trash if it still has the given
+// version, zero skips the check.
+func (db *DB) DeleteSongByIDDB(ctx context.Context, id, version int) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	db.logger.Debugf("delete id=%d version=%d", id, version)
+	commandTag, err := db.conn.Exec(ctx,
+		`UPDATE songs
+	SET deleted_at=now(),
+	    version=version+1
+	WHERE id=$1 AND deleted_at IS NULL AND ($2=0 OR version=$2);`, id, version)
 	if err != nil {
 		db.logger.WithFields(logrus.Fields{
 			"layer":       "db",
 			"function":    "DeleteSongByIDDB",
-			"subFunction": "Query()",
+			"subFunction": "Exec()",
 		}).Errorf("error: %s", err.Error())
 		return err
 	}
-	defer rows.Close()
-	if !rows.Next() {
-		db.logger.WithFields(logrus.Fields{
-			"layer":    "db",
-			"function": "DeleteSongByIDDB",
-		}).Errorf("error: %s", songNotFound.Error())
-		return songNotFound
+	db.logger.Debugf("rows affected=%d", commandTag.RowsAffected())
+	if commandTag.RowsAffected() != 1 {
+		return db.songMissingOrStale(ctx, db.conn, id, "DeleteSongByIDDB")
 	}
-	commandTag, err := db.conn.Exec(context.Background(),
-		`DELETE FROM songs
-	WHERE id=$1;`, id)
+	return nil
+}
+
+// rowQuerier is a pool or a transaction.
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...interface{}) pgx.Row
+}
+
+// songMissingOrStale explains a versioned write to song id that changed no
+// row: the song is gone, trashed or purged, or its version moved on.
+func (db *DB) songMissingOrStale(ctx context.Context, q rowQuerier, id int, function string) error {
+	var found bool
+	err := q.QueryRow(ctx,
+		`SELECT EXISTS (SELECT 1 FROM songs WHERE id=$1 AND deleted_at IS NULL);`, id).Scan(&found)
 	if err != nil {
 		db.logger.WithFields(logrus.Fields{
 			"layer":       "db",
-			"function":    "DeleteSongByIDDB",
-			"subFunction": "Exec()",
+			"function":    function,
+			"subFunction": "QueryRow() exists",
 		}).Errorf("error: %s", err.Error())
 		return err
 	}
-	db.logger.Debugf("rows affected=%d", commandTag.RowsAffected())
-	if commandTag.RowsAffected() != 1 {
-		db.logger.WithFields(logrus.Fields{
-			"layer":    "db",
-			"function": "DeleteSongByIDDB",
-		}).Errorf("error: %s", changedColumns.Error())
-		return changedColumns
+	err = songNotFound
+	if found {
+		err = ErrVersionMismatch
 	}
-	return nil
+	db.logger.WithFields(logrus.Fields{
+		"layer":    "db",
+		"function": function,
+	}).Errorf("error: %s", err.Error())
+	return err
 }
 
-func (db *DB) ChangeSongByIDDB(id int, song models.Song) error {
-	rows, err := db.conn.Query(context.Background(),
-		`SELECT id FROM songs WHERE id=$1;`, id)
+// ChangeSongByIDDB replaces the song if it still has the given version, zero
+// skips the check.
+func (db *DB) ChangeSongByIDDB(ctx context.Context, id, version int, song models.Song) (models.Song, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	tx, err := db.conn.Begin(ctx)
 	if err != nil {
 		db.logger.WithFields(logrus.Fields{
 			"layer":       "db",
 			"function":    "ChangeSongByIDDB",
-			"subFunction": "Query()",
+			"subFunction": "Begin()",
 		}).Errorf("error: %s", err.Error())
-		return err
-	}
-	defer rows.Close()
-	if !rows.Next() {
-		db.logger.WithFields(logrus.Fields{
-			"layer":    "db",
-			"function": "ChangeSongByIDDB",
-		}).Errorf("error: %s", songNotFound.Error())
-		return songNotFound
+		return models.Song{}, err
 	}
+	defer tx.Rollback(ctx)
 
-	commandTag, err := db.conn.Exec(context.Background(),
-		`UPDATE songs
-	SET group_name=$1,
+	changed := songRow{}
+	err = tx.QueryRow(ctx,
+		`WITH artist AS (
+	    INSERT INTO artists (name) VALUES ($1)
+	    ON CONFLICT (name) DO UPDATE SET name=EXCLUDED.name
+	    RETURNING id, name
+	)
+	UPDATE songs
+	SET artist_id=(SELECT id FROM artist),
 	    song_name=$2,
 	    song_text=$3,
 	    release_date=$4,
-	    link=$5
-	WHERE id=$6;`,
-		song.Group, song.Song, song.Text, song.ReleaseDate, song.Link, id)
+	    link=$5,
+	    updated_at=now(),
+	    version=version+1
+	WHERE id=$6 AND deleted_at IS NULL AND ($7=0 OR version=$7)
+	RETURNING id, artist_id, (SELECT name FROM artist), song_name, song_text, release_date, link, created_at, updated_at, version, status;`,
+		song.Group, song.Song, song.Text, releaseDateArg(song.ReleaseDate), song.Link, id, version).
+		Scan(changed.dest()...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.Song{}, db.songMissingOrStale(ctx, tx, id, "ChangeSongByIDDB")
+	}
 	if err != nil {
 		db.logger.WithFields(logrus.Fields{
 			"layer":       "db",
 			"function":    "ChangeSongByIDDB",
-			"subFunction": "Exec()",
+			"subFunction": "QueryRow()",
 		}).Errorf("error: %s", err.Error())
-		return err
+		return models.Song{}, err
 	}
-	db.logger.Debugf("rows affected=%d", commandTag.RowsAffected())
-	if commandTag.RowsAffected() != 1 {
+	if err = db.checkSongRenamed(ctx, tx, id, "ChangeSongByIDDB"); err != nil {
+		return models.Song{}, err
+	}
+	if err = db.addRevisions(ctx, tx, "ChangeSongByIDDB", id); err != nil {
+		return models.Song{}, err
+	}
+	if err = tx.Commit(ctx); err != nil {
 		db.logger.WithFields(logrus.Fields{
-			"layer":    "db",
-			"function": "ChangeSongByIDDB",
-		}).Errorf("error: %s", changedColumns.Error())
-		return changedColumns
+			"layer":       "db",
+			"function":    "ChangeSongByIDDB",
+			"subFunction": "Commit()",
+		}).Errorf("error: %s", err.Error())
+		return models.Song{}, err
 	}
-	return nil
+	db.logger.Debugf("changed song id=%d", changed.song.ID)
+	return changed.result(), nil
 }
 
-func (db *DB) AddSongDB(song models.Song) error {
+// checkSongRenamed fails a change that gave song id the group and song name
+// of another song, the rule addSong applies to new songs: a live duplicate
+// is a conflict and a trashed one has to be restored instead.
+func (db *DB) checkSongRenamed(ctx context.Context, tx pgx.Tx, id int, function string) error {
+	var found, trashed bool
+	err := tx.QueryRow(ctx,
+		`SELECT count(*) != 0, COALESCE(bool_and(o.deleted_at IS NOT NULL), false)
+	FROM songs s
+	JOIN songs o ON o.artist_id = s.artist_id AND o.song_name = s.song_name AND o.id <> s.id
+	WHERE s.id=$1;`, id).Scan(&found, &trashed)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    function,
+			"subFunction": "QueryRow() duplicate",
+		}).Errorf("error: %s", err.Error())
+		return err
+	}
+	switch {
+	case found && trashed:
+		err = ErrSongInTrash
+	case found:
+		err = songAlreadyInDB
+	default:
+		return nil
+	}
+	db.logger.WithFields(logrus.Fields{
+		"layer":    "db",
+		"function": function,
+	}).Errorf("error: %s", err.Error())
+	return err
+}
+
+func (db *DB) AddSongDB(ctx context.Context, song models.Song) (models.Song, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	return db.addSong(ctx, "AddSongDB", song, false)
+}
+
+// AddPendingSongDB adds a song with the pending status and queues it for the
+// song info service in the same transaction.
+func (db *DB) AddPendingSongDB(ctx context.Context, song models.Song) (models.Song, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	return db.addSong(ctx, "AddPendingSongDB", song, true)
+}
+
+func (db *DB) addSong(ctx context.Context, function string, song models.Song, pending bool) (models.Song, error) {
 	db.logger.Debugf("changing to data: song=%s group=%s release=%s link=%s text=%s", song.Song, song.Group, song.ReleaseDate, song.Link, song.Text)
-	rows, err := db.conn.Query(context.Background(),
-		`SELECT id FROM songs WHERE song_name=$1 AND group_name=$2;`, song.Song, song.Group)
+	rows, err := db.conn.Query(ctx,
+		`SELECT s.deleted_at IS NOT NULL FROM songs s
+	JOIN artists a ON a.id = s.artist_id
+	WHERE s.song_name=$1 AND a.name=$2;`, song.Song, song.Group)
 	if err != nil {
 		db.logger.WithFields(logrus.Fields{
 			"layer":       "db",
-			"function":    "AddSongDB",
+			"function":    function,
 			"subFunction": "Query()",
 		}).Errorf("error: %s", err.Error())
-		return err
+		return models.Song{}, err
 	}
-	defer rows.Close()
+	var found, trashed bool
 	if rows.Next() {
+		found = true
+		err = rows.Scan(&trashed)
+	}
+	rows.Close()
+	if err == nil {
+		err = rows.Err()
+	}
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    function,
+			"subFunction": "rows.Err()",
+		}).Errorf("error: %s", err.Error())
+		return models.Song{}, err
+	}
+	if found {
+		// A trashed song still owns its name, it comes back by restoring it.
+		if trashed {
+			db.logger.WithFields(logrus.Fields{
+				"layer":    "db",
+				"function": function,
+			}).Errorf("error: %s", ErrSongInTrash.Error())
+			return models.Song{}, ErrSongInTrash
+		}
 		db.logger.WithFields(logrus.Fields{
 			"layer":    "db",
-			"function": "AddSongDB",
+			"function": function,
 		}).Errorf("error: %s", songAlreadyInDB.Error())
-		return songAlreadyInDB
+		return models.Song{}, songAlreadyInDB
 	}
 
-	_, err = db.conn.Exec(context.Background(),
-		`INSERT INTO songs(group_name, song_name, song_text, release_date, link)
-	VALUES ($1, $2, $3, $4, $5);`,
-		song.Group, song.Song, song.Text, song.ReleaseDate, song.Link)
+	tx, err := db.conn.Begin(ctx)
 	if err != nil {
 		db.logger.WithFields(logrus.Fields{
 			"layer":       "db",
-			"function":    "AddSongDB",
+			"function":    function,
+			"subFunction": "Begin()",
+		}).Errorf("error: %s", err.Error())
+		return models.Song{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	created := song
+	err = tx.QueryRow(ctx,
+		`WITH artist AS (
+	    INSERT INTO artists (name) VALUES ($1)
+	    ON CONFLICT (name) DO UPDATE SET name=EXCLUDED.name
+	    RETURNING id
+	)
+	INSERT INTO songs(artist_id, song_name, song_text, release_date, link, status)
+	SELECT id, $2, $3, $4::date, $5, CASE WHEN $6 THEN 'pending' ELSE 'ready' END FROM artist
+	RETURNING id, artist_id, created_at, updated_at, version, status;`,
+		song.Group, song.Song, song.Text, releaseDateArg(song.ReleaseDate), song.Link, pending).
+		Scan(&created.ID, &created.ArtistID, &created.CreatedAt, &created.UpdatedAt, &created.Version, &created.Status)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    function,
+			"subFunction": "QueryRow()",
+		}).Errorf("error: %s", err.Error())
+		return models.Song{}, err
+	}
+	if err = db.addRevisions(ctx, tx, function, created.ID); err != nil {
+		return models.Song{}, err
+	}
+	if pending {
+		if _, err = tx.Exec(ctx,
+			`INSERT INTO enrichment_jobs (song_id) VALUES ($1);`, created.ID); err != nil {
+			db.logger.WithFields(logrus.Fields{
+				"layer":       "db",
+				"function":    function,
+				"subFunction": "Exec() job",
+			}).Errorf("error: %s", err.Error())
+			return models.Song{}, err
+		}
+	}
+	if err = tx.Commit(ctx); err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    function,
+			"subFunction": "Commit()",
+		}).Errorf("error: %s", err.Error())
+		return models.Song{}, err
+	}
+	db.logger.Debugf("created song id=%d", created.ID)
+	return created, nil
+}
+
+// patchColumns maps the JSON fields of a song merge patch to their columns.
+var patchColumns = []struct {
+	field  string
+	column string
+}{
+	{"song", "song_name"},
+	{"text", "song_text"},
+	{"releaseDate", "release_date"},
+	{"link", "link"},
+}
+
+// PatchSongByIDDB updates only the fields present in patch. A nil value is a
+// JSON null: it clears the release date and empties text and link. A group
+// moves the song to the artist with that name, creating it if needed. As with
+// ChangeSongByIDDB a non-zero version has to match.
+func (db *DB) PatchSongByIDDB(ctx context.Context, id, version int, patch map[string]*string) (models.Song, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	db.logger.Debugf("patch id=%d fields=%d", id, len(patch))
+	query := ""
+	sets := make([]string, 0, len(patch)+1)
+	values := make([]interface{}, 0, len(patch)+1)
+	if group, ok := patch["group"]; ok && group != nil {
+		values = append(values, *group)
+		query += fmt.Sprintf(`WITH artist AS (
+	    INSERT INTO artists (name) VALUES ($%d)
+	    ON CONFLICT (name) DO UPDATE SET name=EXCLUDED.name
+	    RETURNING id
+	)
+	`, len(values))
+		sets = append(sets, "artist_id=(SELECT id FROM artist)")
+	}
+	for _, pc := range patchColumns {
+		value, ok := patch[pc.field]
+		if !ok {
+			continue
+		}
+		switch {
+		case pc.field == "releaseDate" && value != nil:
+			values = append(values, releaseDateArg(*value))
+		case pc.field == "releaseDate":
+			values = append(values, nil)
+		case value == nil:
+			values = append(values, "")
+		default:
+			values = append(values, *value)
+		}
+		sets = append(sets, fmt.Sprintf("%s=$%d", pc.column, len(values)))
+	}
+	sets = append(sets, "updated_at=now()", "version=version+1")
+	values = append(values, id, version)
+	query += fmt.Sprintf("UPDATE songs SET %s WHERE id=$%d AND deleted_at IS NULL AND ($%d=0 OR version=$%d);",
+		strings.Join(sets, ", "), len(values)-1, len(values), len(values))
+
+	tx, err := db.conn.Begin(ctx)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "PatchSongByIDDB",
+			"subFunction": "Begin()",
+		}).Errorf("error: %s", err.Error())
+		return models.Song{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	db.logger.Debugf("SQL query: %s", query)
+	commandTag, err := tx.Exec(ctx, query, values...)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "PatchSongByIDDB",
 			"subFunction": "Exec()",
 		}).Errorf("error: %s", err.Error())
-		return err
+		return models.Song{}, err
 	}
-	return nil
+	db.logger.Debugf("rows affected=%d", commandTag.RowsAffected())
+	if commandTag.RowsAffected() != 1 {
+		return models.Song{}, db.songMissingOrStale(ctx, tx, id, "PatchSongByIDDB")
+	}
+	if err = db.checkSongRenamed(ctx, tx, id, "PatchSongByIDDB"); err != nil {
+		return models.Song{}, err
+	}
+	if err = db.addRevisions(ctx, tx, "PatchSongByIDDB", id); err != nil {
+		return models.Song{}, err
+	}
+	if err = tx.Commit(ctx); err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "PatchSongByIDDB",
+			"subFunction": "Commit()",
+		}).Errorf("error: %s", err.Error())
+		return models.Song{}, err
+	}
+	return db.SearchSongByIDDB(ctx, id)
 }
@@ -0,0 +1,133 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/mao360/musicLib/models"
+	"github.com/mao360/musicLib/pkg/apperrors"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+var revisionNotFound = apperrors.New(apperrors.NotFound, "revision not found")
+
+const revisionsSelect = `SELECT song_id, revision, artist_name, song_name, song_text, release_date, link, created_at
+	FROM song_revisions`
+
+// addRevisions appends the current state of the songs to their history. It
+// runs in the transaction that changed them, so a revision exists exactly
+// when the change was committed.
+func (db *DB) addRevisions(ctx context.Context, tx pgx.Tx, function string, ids ...int) error {
+	_, err := tx.Exec(ctx,
+		`INSERT INTO song_revisions (song_id, revision, artist_name, song_name, song_text, release_date, link)
+	SELECT s.id,
+	       COALESCE((SELECT max(r.revision) FROM song_revisions r WHERE r.song_id = s.id), 0) + 1,
+	       a.name, s.song_name, s.song_text, s.release_date, s.link
+	FROM songs s
+	JOIN artists a ON a.id = s.artist_id
+	WHERE s.id = ANY($1);`, ids)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    function,
+			"subFunction": "addRevisions()",
+		}).Errorf("error: %s", err.Error())
+		return err
+	}
+	return nil
+}
+
+// revisionRow is the scan target of revisionsSelect columns.
+type revisionRow struct {
+	revision    models.SongRevision
+	releaseDate *time.Time
+}
+
+func (r *revisionRow) dest() []interface{} {
+	return []interface{}{&r.revision.SongID, &r.revision.Revision, &r.revision.Group, &r.revision.Song, &r.revision.Text,
+		&r.releaseDate, &r.revision.Link, &r.revision.CreatedAt}
+}
+
+func (r *revisionRow) result() models.SongRevision {
+	r.revision.ReleaseDate = ""
+	if r.releaseDate != nil {
+		r.revision.ReleaseDate = r.releaseDate.Format(ReleaseDateLayout)
+	}
+	return r.revision
+}
+
+// GetSongRevisionsDB lists the revisions of a song, the newest first.
+func (db *DB) GetSongRevisionsDB(ctx context.Context, songID int) ([]models.SongRevision, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	db.logger.Debugf("song id=%d", songID)
+	if _, err := db.SearchSongByIDDB(ctx, songID); err != nil {
+		return nil, err
+	}
+	rows, err := db.conn.Query(ctx,
+		revisionsSelect+`
+	WHERE song_id=$1
+	ORDER BY revision DESC;`, songID)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "GetSongRevisionsDB",
+			"subFunction": "Query()",
+		}).Errorf("error: %s", err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+	revisions := make([]models.SongRevision, 0)
+	for rows.Next() {
+		row := revisionRow{}
+		if err = rows.Scan(row.dest()...); err != nil {
+			db.logger.WithFields(logrus.Fields{
+				"layer":       "db",
+				"function":    "GetSongRevisionsDB",
+				"subFunction": "Scan()",
+			}).Errorf("error: %s", err.Error())
+			return nil, err
+		}
+		revisions = append(revisions, row.result())
+	}
+	if err = rows.Err(); err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "GetSongRevisionsDB",
+			"subFunction": "rows.Err()",
+		}).Errorf("error: %s", err.Error())
+		return nil, err
+	}
+	db.logger.Debugf("len of revisions list=%d", len(revisions))
+	return revisions, nil
+}
+
+func (db *DB) GetSongRevisionDB(ctx context.Context, songID, revision int) (models.SongRevision, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	db.logger.Debugf("song id=%d revision=%d", songID, revision)
+	if _, err := db.SearchSongByIDDB(ctx, songID); err != nil {
+		return models.SongRevision{}, err
+	}
+	row := revisionRow{}
+	err := db.conn.QueryRow(ctx,
+		revisionsSelect+`
+	WHERE song_id=$1 AND revision=$2;`, songID, revision).Scan(row.dest()...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		db.logger.WithFields(logrus.Fields{
+			"layer":    "db",
+			"function": "GetSongRevisionDB",
+		}).Errorf("error: %s", revisionNotFound.Error())
+		return models.SongRevision{}, revisionNotFound
+	}
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "GetSongRevisionDB",
+			"subFunction": "QueryRow()",
+		}).Errorf("error: %s", err.Error())
+		return models.SongRevision{}, err
+	}
+	return row.result(), nil
+}
@@ -0,0 +1,87 @@
+package postgres
+
+import (
+	"context"
+	"github.com/mao360/musicLib/models"
+	"github.com/sirupsen/logrus"
+)
+
+// SearchSongsDB runs a full-text search over song names and lyrics. config is
+// the postgres text search configuration used to parse the query and to build
+// the highlighted snippet. The lyrics are HTML-escaped before highlighting, so
+// the <b> markers are the only markup a snippet can contain.
+func (db *DB) SearchSongsDB(ctx context.Context, query, config string, limit, offset int) ([]models.SearchResult, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	db.logger.Debugf("query=%s config=%s limit=%d offset=%d", query, config, limit, offset)
+	rows, err := db.conn.Query(ctx,
+		`SELECT s.id, s.artist_id, a.name, s.song_name, s.song_text, s.release_date, s.link, s.created_at, s.updated_at, s.version, s.status,
+	       ts_rank_cd(s.search_vector, q.query) AS rank,
+	       ts_headline($1::regconfig,
+	                   replace(replace(replace(replace(replace(s.song_text,
+	                       '&', '&amp;'), '<', '&lt;'), '>', '&gt;'), '"', '&quot;'), '''', '&#39;'),
+	                   q.query,
+	                   'StartSel=<b>, StopSel=</b>, MaxWords=20, MinWords=5, MaxFragments=3')
+	FROM songs s
+	JOIN artists a ON a.id = s.artist_id,
+	     websearch_to_tsquery($1::regconfig, $2) AS q(query)
+	WHERE s.search_vector @@ q.query AND s.deleted_at IS NULL
+	ORDER BY rank DESC, s.id
+	LIMIT $3 OFFSET $4;`, config, query, limit, offset)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "SearchSongsDB",
+			"subFunction": "Query()",
+		}).Errorf("error: %s", err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+	results := make([]models.SearchResult, 0)
+	for rows.Next() {
+		result := models.SearchResult{}
+		row := songRow{}
+		err = rows.Scan(append(row.dest(), &result.Rank, &result.Snippet)...)
+		if err != nil {
+			db.logger.WithFields(logrus.Fields{
+				"layer":       "db",
+				"function":    "SearchSongsDB",
+				"subFunction": "Scan()",
+			}).Errorf("error: %s", err.Error())
+			return nil, err
+		}
+		result.Song = row.result()
+		results = append(results, result)
+	}
+	if err = rows.Err(); err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "SearchSongsDB",
+			"subFunction": "rows.Err()",
+		}).Errorf("error: %s", err.Error())
+		return nil, err
+	}
+	db.logger.Debugf("len of results list=%d", len(results))
+	return results, nil
+}
+
+func (db *DB) CountSearchSongsDB(ctx context.Context, query, config string) (int, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	db.logger.Debugf("query=%s config=%s", query, config)
+	var count int
+	err := db.conn.QueryRow(ctx,
+		`SELECT count(*)
+	FROM songs s
+	WHERE s.search_vector @@ websearch_to_tsquery($1::regconfig, $2) AND s.deleted_at IS NULL;`, config, query).Scan(&count)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "CountSearchSongsDB",
+			"subFunction": "QueryRow()",
+		}).Errorf("error: %s", err.Error())
+		return 0, err
+	}
+	db.logger.Debugf("count=%d", count)
+	return count, nil
+}
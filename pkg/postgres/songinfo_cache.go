@@ -0,0 +1,106 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"github.com/jackc/pgx/v5"
+	"github.com/mao360/musicLib/models"
+	"github.com/sirupsen/logrus"
+)
+
+// GetSongInfoCacheDB returns the cache entry of key unless it expired, the
+// bool is false on a miss.
+func (db *DB) GetSongInfoCacheDB(ctx context.Context, key string) (models.SongInfoCacheEntry, bool, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	entry := models.SongInfoCacheEntry{Key: key}
+	err := db.conn.QueryRow(ctx,
+		`SELECT info, rejected, expires_at
+	FROM song_info_cache
+	WHERE cache_key=$1 AND expires_at > now();`, key).Scan(&entry.Info, &entry.Rejected, &entry.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.SongInfoCacheEntry{}, false, nil
+	}
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "GetSongInfoCacheDB",
+			"subFunction": "QueryRow()",
+		}).Errorf("error: %s", err.Error())
+		return models.SongInfoCacheEntry{}, false, err
+	}
+	return entry, true, nil
+}
+
+func (db *DB) PutSongInfoCacheDB(ctx context.Context, entry models.SongInfoCacheEntry) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	_, err := db.conn.Exec(ctx,
+		`INSERT INTO song_info_cache (cache_key, info, rejected, expires_at)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (cache_key) DO UPDATE
+	SET info=EXCLUDED.info,
+	    rejected=EXCLUDED.rejected,
+	    expires_at=EXCLUDED.expires_at;`, entry.Key, entry.Info, entry.Rejected, entry.ExpiresAt)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "PutSongInfoCacheDB",
+			"subFunction": "Exec()",
+		}).Errorf("error: %s", err.Error())
+		return err
+	}
+	return nil
+}
+
+func (db *DB) DeleteSongInfoCacheDB(ctx context.Context, key string) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	_, err := db.conn.Exec(ctx,
+		`DELETE FROM song_info_cache WHERE cache_key=$1;`, key)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "DeleteSongInfoCacheDB",
+			"subFunction": "Exec()",
+		}).Errorf("error: %s", err.Error())
+		return err
+	}
+	return nil
+}
+
+// PurgeSongInfoCacheDB deletes the expired entries and returns how many
+// there were.
+func (db *DB) PurgeSongInfoCacheDB(ctx context.Context) (int64, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	commandTag, err := db.conn.Exec(ctx,
+		`DELETE FROM song_info_cache WHERE expires_at <= now();`)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "PurgeSongInfoCacheDB",
+			"subFunction": "Exec()",
+		}).Errorf("error: %s", err.Error())
+		return 0, err
+	}
+	return commandTag.RowsAffected(), nil
+}
+
+// ClearSongInfoCacheDB empties the cache, expired entries included.
+func (db *DB) ClearSongInfoCacheDB(ctx context.Context) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	commandTag, err := db.conn.Exec(ctx,
+		`DELETE FROM song_info_cache;`)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "ClearSongInfoCacheDB",
+			"subFunction": "Exec()",
+		}).Errorf("error: %s", err.Error())
+		return err
+	}
+	db.logger.Debugf("cleared cache entries=%d", commandTag.RowsAffected())
+	return nil
+}
@@ -0,0 +1,154 @@
+package postgres
+
+import (
+	"context"
+	"github.com/mao360/musicLib/models"
+	"github.com/mao360/musicLib/pkg/apperrors"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+var songNotInTrash = apperrors.New(apperrors.NotFound, "song not in trash")
+
+// GetTrashDB lists the songs in the trash, the latest deleted first.
+func (db *DB) GetTrashDB(ctx context.Context, limit, offset int) ([]models.TrashedSong, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	db.logger.Debugf("limit=%d offset=%d", limit, offset)
+	rows, err := db.conn.Query(ctx,
+		`SELECT s.id, s.artist_id, a.name, s.song_name, s.song_text, s.release_date, s.link, s.created_at, s.updated_at, s.version, s.status, s.deleted_at
+	FROM songs s
+	JOIN artists a ON a.id = s.artist_id
+	WHERE s.deleted_at IS NOT NULL
+	ORDER BY s.deleted_at DESC, s.id
+	LIMIT $1 OFFSET $2;`, limit, offset)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "GetTrashDB",
+			"subFunction": "Query()",
+		}).Errorf("error: %s", err.Error())
+		return nil, err
+	}
+	defer rows.Close()
+	songs := make([]models.TrashedSong, 0)
+	for rows.Next() {
+		row := songRow{}
+		trashed := models.TrashedSong{}
+		err = rows.Scan(append(row.dest(), &trashed.DeletedAt)...)
+		if err != nil {
+			db.logger.WithFields(logrus.Fields{
+				"layer":       "db",
+				"function":    "GetTrashDB",
+				"subFunction": "Scan()",
+			}).Errorf("error: %s", err.Error())
+			return nil, err
+		}
+		trashed.Song = row.result()
+		songs = append(songs, trashed)
+	}
+	if err = rows.Err(); err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "GetTrashDB",
+			"subFunction": "rows.Err()",
+		}).Errorf("error: %s", err.Error())
+		return nil, err
+	}
+	db.logger.Debugf("len of trash list=%d", len(songs))
+	return songs, nil
+}
+
+func (db *DB) CountTrashDB(ctx context.Context) (int, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	var count int
+	err := db.conn.QueryRow(ctx,
+		`SELECT count(*) FROM songs WHERE deleted_at IS NOT NULL;`).Scan(&count)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "CountTrashDB",
+			"subFunction": "QueryRow()",
+		}).Errorf("error: %s", err.Error())
+		return 0, err
+	}
+	db.logger.Debugf("count=%d", count)
+	return count, nil
+}
+
+func (db *DB) RestoreSongByIDDB(ctx context.Context, id int) (models.Song, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	db.logger.Debugf("restore id=%d", id)
+	commandTag, err := db.conn.Exec(ctx,
+		`UPDATE songs
+	SET deleted_at=NULL,
+	    updated_at=now(),
+	    version=version+1
+	WHERE id=$1 AND deleted_at IS NOT NULL;`, id)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "RestoreSongByIDDB",
+			"subFunction": "Exec()",
+		}).Errorf("error: %s", err.Error())
+		return models.Song{}, err
+	}
+	if commandTag.RowsAffected() != 1 {
+		db.logger.WithFields(logrus.Fields{
+			"layer":    "db",
+			"function": "RestoreSongByIDDB",
+		}).Errorf("error: %s", songNotInTrash.Error())
+		return models.Song{}, songNotInTrash
+	}
+	return db.SearchSongByIDDB(ctx, id)
+}
+
+// PurgeSongByIDDB deletes a song in the trash for good, songs outside of it
+// have to be deleted first.
+func (db *DB) PurgeSongByIDDB(ctx context.Context, id int) error {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	db.logger.Debugf("purge id=%d", id)
+	commandTag, err := db.conn.Exec(ctx,
+		`DELETE FROM songs
+	WHERE id=$1 AND deleted_at IS NOT NULL;`, id)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "PurgeSongByIDDB",
+			"subFunction": "Exec()",
+		}).Errorf("error: %s", err.Error())
+		return err
+	}
+	if commandTag.RowsAffected() != 1 {
+		db.logger.WithFields(logrus.Fields{
+			"layer":    "db",
+			"function": "PurgeSongByIDDB",
+		}).Errorf("error: %s", songNotInTrash.Error())
+		return songNotInTrash
+	}
+	return nil
+}
+
+// PurgeTrashDB deletes the songs moved to the trash before deletedBefore and
+// returns how many there were.
+func (db *DB) PurgeTrashDB(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	ctx, cancel := db.withTimeout(ctx)
+	defer cancel()
+	db.logger.Debugf("purge deleted before %s", deletedBefore)
+	commandTag, err := db.conn.Exec(ctx,
+		`DELETE FROM songs
+	WHERE deleted_at < $1;`, deletedBefore)
+	if err != nil {
+		db.logger.WithFields(logrus.Fields{
+			"layer":       "db",
+			"function":    "PurgeTrashDB",
+			"subFunction": "Exec()",
+		}).Errorf("error: %s", err.Error())
+		return 0, err
+	}
+	db.logger.Debugf("purged songs=%d", commandTag.RowsAffected())
+	return commandTag.RowsAffected(), nil
+}
@@ -0,0 +1,188 @@
+package service
+
+import (
+	"context"
+	"github.com/mao360/musicLib/models"
+	"github.com/mao360/musicLib/pkg/apperrors"
+	"github.com/sirupsen/logrus"
+	"strconv"
+	"strings"
+)
+
+var (
+	invalidAlbumTitle = apperrors.Field("title", "invalid album title")
+	invalidPosition   = apperrors.Field("position", "invalid track position")
+	invalidTrackOrder = apperrors.Field("songIds", "invalid track order")
+)
+
+func (s *Service) GetAlbumByID(ctx context.Context, albumID string) (models.Album, error) {
+	id, err := strconv.Atoi(albumID)
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "GetAlbumByID",
+			"subFunction": "Atoi() albumID",
+		}).Errorf("error: %s", err.Error())
+		return models.Album{}, invalidAlbumID
+	}
+	album, err := s.repo.SearchAlbumByIDDB(ctx, id)
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "GetAlbumByID",
+			"subFunction": "SearchAlbumByIDDB",
+		}).Errorf("error: %s", err.Error())
+		return models.Album{}, err
+	}
+	return album, nil
+}
+
+func (s *Service) AddAlbum(ctx context.Context, album models.Album) (models.Album, error) {
+	album.Title = strings.TrimSpace(album.Title)
+	if album.Title == "" {
+		s.logger.WithFields(logrus.Fields{
+			"layer":    "service",
+			"function": "AddAlbum",
+		}).Errorf("error: %s", invalidAlbumTitle.Error())
+		return models.Album{}, invalidAlbumTitle
+	}
+	if err := validateNameLength("title", album.Title); err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "AddAlbum",
+			"subFunction": "validateNameLength title",
+		}).Errorf("error: %s", err.Error())
+		return models.Album{}, err
+	}
+	if album.ReleaseDate != "" && !CheckDate(album.ReleaseDate) {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "AddAlbum",
+			"subFunction": "CheckDate",
+		}).Errorf("error: %s", invalidDate.Error())
+		return models.Album{}, invalidDate
+	}
+	if album.CoverLink != "" && !CheckLink(album.CoverLink) {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "AddAlbum",
+			"subFunction": "CheckLink",
+		}).Errorf("error: %s", invalidLink.Error())
+		return models.Album{}, invalidLink
+	}
+	if err := validateNameLength("coverLink", album.CoverLink); err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "AddAlbum",
+			"subFunction": "validateNameLength coverLink",
+		}).Errorf("error: %s", err.Error())
+		return models.Album{}, err
+	}
+	if _, err := s.repo.SearchArtistByIDDB(ctx, album.ArtistID); err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "AddAlbum",
+			"subFunction": "SearchArtistByIDDB",
+		}).Errorf("error: %s", err.Error())
+		return models.Album{}, err
+	}
+	s.logger.Debugf("artistID=%d title=%s release=%s cover=%s", album.ArtistID, album.Title, album.ReleaseDate, album.CoverLink)
+	created, err := s.repo.AddAlbumDB(ctx, album)
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "AddAlbum",
+			"subFunction": "AddAlbumDB",
+		}).Errorf("error: %s", err.Error())
+		return models.Album{}, err
+	}
+	s.logger.Debugf("created id=%d", created.ID)
+	return created, nil
+}
+
+func (s *Service) GetAlbumTracks(ctx context.Context, albumID string) ([]models.Track, error) {
+	id, err := strconv.Atoi(albumID)
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "GetAlbumTracks",
+			"subFunction": "Atoi() albumID",
+		}).Errorf("error: %s", err.Error())
+		return nil, invalidAlbumID
+	}
+	tracks, err := s.repo.GetAlbumTracksDB(ctx, id)
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "GetAlbumTracks",
+			"subFunction": "GetAlbumTracksDB",
+		}).Errorf("error: %s", err.Error())
+		return nil, err
+	}
+	s.logger.Debugf("len(tracks)=%d", len(tracks))
+	return tracks, nil
+}
+
+// AttachTrack puts a song on the album. A zero position appends it after
+// the last track.
+func (s *Service) AttachTrack(ctx context.Context, albumID string, track models.TrackAttach) error {
+	id, err := strconv.Atoi(albumID)
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "AttachTrack",
+			"subFunction": "Atoi() albumID",
+		}).Errorf("error: %s", err.Error())
+		return invalidAlbumID
+	}
+	if track.Position < 0 {
+		s.logger.WithFields(logrus.Fields{
+			"layer":    "service",
+			"function": "AttachTrack",
+		}).Errorf("error: %s", invalidPosition.Error())
+		return invalidPosition
+	}
+	s.logger.Debugf("id=%d songID=%d position=%d", id, track.SongID, track.Position)
+	if err = s.repo.AttachTrackDB(ctx, id, track); err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "AttachTrack",
+			"subFunction": "AttachTrackDB",
+		}).Errorf("error: %s", err.Error())
+		return err
+	}
+	return nil
+}
+
+func (s *Service) ReorderTracks(ctx context.Context, albumID string, order models.TrackOrder) error {
+	id, err := strconv.Atoi(albumID)
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "ReorderTracks",
+			"subFunction": "Atoi() albumID",
+		}).Errorf("error: %s", err.Error())
+		return invalidAlbumID
+	}
+	seen := make(map[int]struct{}, len(order.SongIDs))
+	for _, songID := range order.SongIDs {
+		if _, ok := seen[songID]; ok {
+			s.logger.WithFields(logrus.Fields{
+				"layer":    "service",
+				"function": "ReorderTracks",
+			}).Errorf("error: %s", invalidTrackOrder.Error())
+			return invalidTrackOrder
+		}
+		seen[songID] = struct{}{}
+	}
+	s.logger.Debugf("id=%d songIDs=%v", id, order.SongIDs)
+	if err = s.repo.ReorderTracksDB(ctx, id, order.SongIDs); err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "ReorderTracks",
+			"subFunction": "ReorderTracksDB",
+		}).Errorf("error: %s", err.Error())
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"github.com/mao360/musicLib/models"
+	"github.com/mao360/musicLib/pkg/apperrors"
+	"github.com/sirupsen/logrus"
+	"strconv"
+	"strings"
+)
+
+var (
+	invalidArtistName   = apperrors.Field("name", "invalid artist name")
+	invalidDeletePolicy = apperrors.Field("policy", "invalid delete policy")
+)
+
+const (
+	DeletePolicyRestrict = "restrict"
+	DeletePolicyCascade  = "cascade"
+)
+
+func (s *Service) GetArtists(ctx context.Context, pageSize, page string) (models.Page, error) {
+	s.logger.Debugf("pageSize=%s, page=%s", pageSize, page)
+	pageNum, err := strconv.Atoi(page)
+	if err != nil || pageNum <= 0 {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "GetArtists",
+			"subFunction": "Atoi() and page > 0",
+		}).Errorf("error: %s", invalidPage.Error())
+		return models.Page{}, invalidPage
+	}
+	limit, err := strconv.Atoi(pageSize)
+	if err != nil || limit <= 0 {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "GetArtists",
+			"subFunction": "Atoi() and pageSize > 0",
+		}).Errorf("error: %s", invalidPageSize.Error())
+		return models.Page{}, invalidPageSize
+	}
+	offset := (pageNum - 1) * limit
+
+	total, err := s.repo.CountArtistsDB(ctx)
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "GetArtists",
+			"subFunction": "CountArtistsDB",
+		}).Errorf("error: %s", err.Error())
+		return models.Page{}, err
+	}
+	artists, err := s.repo.GetArtistsDB(ctx, limit, offset)
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "GetArtists",
+			"subFunction": "GetArtistsDB",
+		}).Errorf("error: %s", err.Error())
+		return models.Page{}, err
+	}
+	s.logger.Debugf("len(artists)=%d total=%d", len(artists), total)
+	return models.Page{Items: artists, Total: total, Page: pageNum, PageSize: limit}, nil
+}
+
+func (s *Service) GetArtistByID(ctx context.Context, artistID string) (models.Artist, error) {
+	id, err := strconv.Atoi(artistID)
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "GetArtistByID",
+			"subFunction": "Atoi() artistID",
+		}).Errorf("error: %s", err.Error())
+		return models.Artist{}, invalidArtistID
+	}
+	artist, err := s.repo.SearchArtistByIDDB(ctx, id)
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "GetArtistByID",
+			"subFunction": "SearchArtistByIDDB",
+		}).Errorf("error: %s", err.Error())
+		return models.Artist{}, err
+	}
+	return artist, nil
+}
+
+func (s *Service) AddArtist(ctx context.Context, artist models.Artist) (models.Artist, error) {
+	artist.Name = strings.TrimSpace(artist.Name)
+	if artist.Name == "" {
+		s.logger.WithFields(logrus.Fields{
+			"layer":    "service",
+			"function": "AddArtist",
+		}).Errorf("error: %s", invalidArtistName.Error())
+		return models.Artist{}, invalidArtistName
+	}
+	if err := validateNameLength("name", artist.Name); err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "AddArtist",
+			"subFunction": "validateNameLength",
+		}).Errorf("error: %s", err.Error())
+		return models.Artist{}, err
+	}
+	created, err := s.repo.AddArtistDB(ctx, artist)
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "AddArtist",
+			"subFunction": "AddArtistDB",
+		}).Errorf("error: %s", err.Error())
+		return models.Artist{}, err
+	}
+	s.logger.Debugf("created id=%d", created.ID)
+	return created, nil
+}
+
+func (s *Service) RenameArtistByID(ctx context.Context, artistID string, artist models.Artist) (models.Artist, error) {
+	id, err := strconv.Atoi(artistID)
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "RenameArtistByID",
+			"subFunction": "Atoi() artistID",
+		}).Errorf("error: %s", err.Error())
+		return models.Artist{}, invalidArtistID
+	}
+	name := strings.TrimSpace(artist.Name)
+	if name == "" {
+		s.logger.WithFields(logrus.Fields{
+			"layer":    "service",
+			"function": "RenameArtistByID",
+		}).Errorf("error: %s", invalidArtistName.Error())
+		return models.Artist{}, invalidArtistName
+	}
+	if err = validateNameLength("name", name); err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "RenameArtistByID",
+			"subFunction": "validateNameLength",
+		}).Errorf("error: %s", err.Error())
+		return models.Artist{}, err
+	}
+	s.logger.Debugf("id=%d name=%s", id, name)
+	renamed, err := s.repo.RenameArtistByIDDB(ctx, id, name)
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "RenameArtistByID",
+			"subFunction": "RenameArtistByIDDB",
+		}).Errorf("error: %s", err.Error())
+		return models.Artist{}, err
+	}
+	return renamed, nil
+}
+
+// DeleteArtistByID deletes an artist according to policy: "restrict" (the
+// default) fails while the artist has songs or albums, "cascade" deletes them
+// too.
+func (s *Service) DeleteArtistByID(ctx context.Context, artistID, policy string) error {
+	id, err := strconv.Atoi(artistID)
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "DeleteArtistByID",
+			"subFunction": "Atoi() artistID",
+		}).Errorf("error: %s", err.Error())
+		return invalidArtistID
+	}
+	if policy == "" {
+		policy = DeletePolicyRestrict
+	}
+	if policy != DeletePolicyRestrict && policy != DeletePolicyCascade {
+		s.logger.WithFields(logrus.Fields{
+			"layer":    "service",
+			"function": "DeleteArtistByID",
+		}).Errorf("error: %s", invalidDeletePolicy.Error())
+		return invalidDeletePolicy
+	}
+	s.logger.Debugf("id=%d policy=%s", id, policy)
+	if err = s.repo.DeleteArtistByIDDB(ctx, id, policy == DeletePolicyCascade); err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "DeleteArtistByID",
+			"subFunction": "DeleteArtistByIDDB",
+		}).Errorf("error: %s", err.Error())
+		return err
+	}
+	return nil
+}
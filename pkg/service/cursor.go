@@ -0,0 +1,29 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/mao360/musicLib/models"
+	"github.com/mao360/musicLib/pkg/apperrors"
+)
+
+var invalidCursor = apperrors.Field("cursor", "invalid cursor")
+
+// EncodeCursor turns a cursor into the opaque string handed out to clients.
+func EncodeCursor(cursor models.Cursor) string {
+	data, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses a string produced by EncodeCursor.
+func DecodeCursor(encoded string) (models.Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return models.Cursor{}, invalidCursor
+	}
+	cursor := models.Cursor{}
+	if err = json.Unmarshal(data, &cursor); err != nil || len(cursor.Keys) == 0 {
+		return models.Cursor{}, invalidCursor
+	}
+	return cursor, nil
+}
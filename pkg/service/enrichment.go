@@ -0,0 +1,218 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"github.com/mao360/musicLib/models"
+	"github.com/mao360/musicLib/pkg/apperrors"
+	"github.com/sirupsen/logrus"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var invalidJobID = apperrors.New(apperrors.Validation, "invalid job id")
+
+// EnrichmentConfig sets up the workers filling pending songs in from the
+// song info service.
+type EnrichmentConfig struct {
+	// Workers is the number of jobs handled at once, zero stops enrichment.
+	Workers int
+	// MaxAttempts failed attempts send a job to the dead letters.
+	MaxAttempts int
+	// Backoff is the pause after the first failed attempt, doubled after
+	// each next one up to MaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Lease is how long a claimed job is hidden from the other workers, a
+	// job of a worker gone is claimed again after it.
+	Lease time.Duration
+	// PollInterval is the pause of an idle worker.
+	PollInterval time.Duration
+}
+
+// AddPendingSong stores the song right away with the pending status and
+// queues it for the song info service.
+func (s *Service) AddPendingSong(ctx context.Context, song models.Song) (models.Song, error) {
+	if err := ValidatePendingSong(song); err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "AddPendingSong",
+			"subFunction": "ValidatePendingSong",
+		}).Errorf("error: %s", err.Error())
+		return models.Song{}, err
+	}
+	s.logger.Debugf("song=%s group=%s", song.Song, song.Group)
+	created, err := s.repo.AddPendingSongDB(ctx, song)
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "AddPendingSong",
+			"subFunction": "AddPendingSongDB",
+		}).Errorf("error: %s", err.Error())
+		return models.Song{}, err
+	}
+	s.logger.Debugf("created pending id=%d", created.ID)
+	return created, nil
+}
+
+// RunEnrichment runs the enrichment workers until ctx is done.
+func (s *Service) RunEnrichment(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < s.enrichment.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				handled, err := s.EnrichNext(ctx)
+				if handled && err == nil {
+					continue
+				}
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(s.enrichment.PollInterval):
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// EnrichNext handles the next due job, if there is one. A failed attempt is
+// retried after a backoff unless it is the last one or the song info service
+// rejected the song; the job then goes to the dead letters.
+func (s *Service) EnrichNext(ctx context.Context) (bool, error) {
+	job, found, err := s.repo.ClaimEnrichmentJobDB(ctx, s.enrichment.Lease)
+	if err != nil || !found {
+		return false, err
+	}
+	s.logger.Debugf("job id=%d song id=%d attempt=%d", job.ID, job.SongID, job.Attempts)
+
+	infoCtx, cancel := context.WithTimeout(ctx, s.enrichment.Lease)
+	info, err := s.songInfo.GetSongInfo(infoCtx, job.Group, job.Song)
+	cancel()
+	if err == nil {
+		err = validateSongInfo(info)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			// Shutting down, the job is claimed again once its lease is over.
+			return true, ctx.Err()
+		}
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "EnrichNext",
+			"subFunction": "GetSongInfo",
+			"jobId":       job.ID,
+		}).Errorf("error: %s", err.Error())
+		if errors.Is(err, apperrors.ErrValidation) || job.Attempts >= s.enrichment.MaxAttempts {
+			err = s.repo.DeadLetterEnrichmentJobDB(ctx, job, err.Error())
+		} else {
+			runAt := time.Now().Add(s.retryBackoff(job.Attempts))
+			err = s.repo.RetryEnrichmentJobDB(ctx, job, runAt, err.Error())
+		}
+		return true, err
+	}
+
+	if err = s.repo.CompleteEnrichmentJobDB(ctx, job, info); err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "EnrichNext",
+			"subFunction": "CompleteEnrichmentJobDB",
+		}).Errorf("error: %s", err.Error())
+		return true, err
+	}
+	s.logger.Infof("enriched song id=%d", job.SongID)
+	return true, nil
+}
+
+// retryBackoff is the pause after the given failed attempt: Backoff doubled
+// for every attempt after the first, capped at MaxBackoff (at least Backoff).
+func (s *Service) retryBackoff(attempts int) time.Duration {
+	limit := max(s.enrichment.MaxBackoff, s.enrichment.Backoff)
+	backoff := s.enrichment.Backoff
+	for i := 1; i < attempts && backoff > 0 && backoff < limit; i++ {
+		backoff *= 2
+	}
+	return min(backoff, limit)
+}
+
+// validateSongInfo checks the details the song info service sent, the empty
+// ones are left unset.
+func validateSongInfo(info models.Song) error {
+	return validateFields([]songField{
+		{"text", info.Text},
+		{"releaseDate", info.ReleaseDate},
+		{"link", info.Link},
+	}, true)
+}
+
+// GetDeadEnrichmentJobs returns a page of the jobs that failed for good.
+func (s *Service) GetDeadEnrichmentJobs(ctx context.Context, pageSize, page string) (models.Page, error) {
+	s.logger.Debugf("pageSize=%s, page=%s", pageSize, page)
+	pageNum, err := strconv.Atoi(page)
+	if err != nil || pageNum <= 0 {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "GetDeadEnrichmentJobs",
+			"subFunction": "Atoi() and page > 0",
+		}).Errorf("error: %s", invalidPage.Error())
+		return models.Page{}, invalidPage
+	}
+	limit, err := strconv.Atoi(pageSize)
+	if err != nil || limit <= 0 {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "GetDeadEnrichmentJobs",
+			"subFunction": "Atoi() and pageSize > 0",
+		}).Errorf("error: %s", invalidPageSize.Error())
+		return models.Page{}, invalidPageSize
+	}
+	offset := (pageNum - 1) * limit
+
+	total, err := s.repo.CountDeadEnrichmentJobsDB(ctx)
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "GetDeadEnrichmentJobs",
+			"subFunction": "CountDeadEnrichmentJobsDB",
+		}).Errorf("error: %s", err.Error())
+		return models.Page{}, err
+	}
+	jobs, err := s.repo.GetDeadEnrichmentJobsDB(ctx, limit, offset)
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "GetDeadEnrichmentJobs",
+			"subFunction": "GetDeadEnrichmentJobsDB",
+		}).Errorf("error: %s", err.Error())
+		return models.Page{}, err
+	}
+	s.logger.Debugf("len(jobs)=%d total=%d", len(jobs), total)
+	return models.Page{Items: jobs, Total: total, Page: pageNum, PageSize: limit}, nil
+}
+
+// RequeueEnrichmentJob gives a dead letter a new round of attempts.
+func (s *Service) RequeueEnrichmentJob(ctx context.Context, jobID string) (models.EnrichmentJob, error) {
+	id, err := strconv.Atoi(jobID)
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "RequeueEnrichmentJob",
+			"subFunction": "Atoi() jobID",
+		}).Errorf("error: %s", err.Error())
+		return models.EnrichmentJob{}, invalidJobID
+	}
+	s.logger.Debugf("id=%d", id)
+	job, err := s.repo.RequeueEnrichmentJobDB(ctx, id)
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "RequeueEnrichmentJob",
+			"subFunction": "RequeueEnrichmentJobDB",
+		}).Errorf("error: %s", err.Error())
+		return models.EnrichmentJob{}, err
+	}
+	return job, nil
+}
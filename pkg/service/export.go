@@ -0,0 +1,36 @@
+package service
+
+import (
+	"context"
+	"github.com/mao360/musicLib/models"
+	"github.com/sirupsen/logrus"
+)
+
+// ExportSongs passes every song matching the filters of GetSongsByFilter to
+// fn, ordered by sort. The filters are validated before the first song is
+// read, so a returned error that didn't come from fn means nothing was
+// exported.
+func (s *Service) ExportSongs(ctx context.Context, filters, matches map[string]string, sort string, fn func(models.Song) error) error {
+	s.logger.Debugf("sort=%s", sort)
+	sortFields, err := ParseSort(sort)
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "ExportSongs",
+			"subFunction": "ParseSort",
+		}).Errorf("error: %s", err.Error())
+		return err
+	}
+	if err = s.checkSongFilters(filters, matches, "ExportSongs"); err != nil {
+		return err
+	}
+	if err = s.repo.ExportSongsDB(ctx, filters, matches, sortFields, fn); err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "ExportSongs",
+			"subFunction": "ExportSongsDB",
+		}).Errorf("error: %s", err.Error())
+		return err
+	}
+	return nil
+}
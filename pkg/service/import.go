@@ -0,0 +1,257 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mao360/musicLib/models"
+	"github.com/mao360/musicLib/pkg/apperrors"
+	"github.com/mao360/musicLib/pkg/postgres"
+	"github.com/sirupsen/logrus"
+	"io"
+	"slices"
+	"strings"
+)
+
+const (
+	ImportFormatCSV    = "csv"
+	ImportFormatNDJSON = "ndjson"
+
+	ImportStatusCreated   = "created"
+	ImportStatusDuplicate = "skipped"
+	ImportStatusInvalid   = "invalid"
+
+	importBatchSize = 500
+)
+
+var (
+	invalidImportFormat = apperrors.Field("format", "invalid import format, use csv or ndjson")
+	invalidCSVHeader    = apperrors.New(apperrors.Validation, "csv header must contain group and song columns")
+)
+
+// csvColumns maps the accepted CSV header names to models.Song JSON fields.
+var csvColumns = map[string]string{
+	"group":        "group",
+	"group_name":   "group",
+	"song":         "song",
+	"song_name":    "song",
+	"text":         "text",
+	"song_text":    "text",
+	"releasedate":  "releaseDate",
+	"release_date": "releaseDate",
+	"link":         "link",
+}
+
+// ImportSongs reads songs from a CSV file with a header row or from NDJSON,
+// one song object per line, without loading the whole file. Every row is
+// checked like AddSong does, the valid ones are stored in batches. Rows are
+// numbered from 1, not counting the CSV header and blank NDJSON lines.
+//
+// Each batch is committed on its own. When reading or storing fails halfway
+// the report of the rows handled so far comes with the error, rows missing
+// from it were not stored.
+func (s *Service) ImportSongs(ctx context.Context, r io.Reader, format string) (models.ImportReport, error) {
+	var next func() (models.Song, error)
+	switch strings.ToLower(format) {
+	case ImportFormatCSV:
+		reader, err := newCSVSongReader(r)
+		if err != nil {
+			s.logger.WithFields(logrus.Fields{
+				"layer":       "service",
+				"function":    "ImportSongs",
+				"subFunction": "newCSVSongReader",
+			}).Errorf("error: %s", err.Error())
+			return models.ImportReport{}, err
+		}
+		next = reader.next
+	case ImportFormatNDJSON:
+		next = newNDJSONSongReader(r).next
+	default:
+		s.logger.WithFields(logrus.Fields{
+			"layer":    "service",
+			"function": "ImportSongs",
+		}).Errorf("error: %s", invalidImportFormat.Error())
+		return models.ImportReport{}, invalidImportFormat
+	}
+
+	report := models.ImportReport{Rows: make([]models.ImportRow, 0)}
+	batch := make(map[int]models.Song, importBatchSize)
+	for rowNum := 1; ; rowNum++ {
+		song, err := next()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *rowError
+		if errors.As(err, &parseErr) {
+			report.Rows = append(report.Rows, models.ImportRow{Row: rowNum, Status: ImportStatusInvalid, Error: parseErr.Error()})
+			continue
+		}
+		if err != nil {
+			s.logger.WithFields(logrus.Fields{
+				"layer":       "service",
+				"function":    "ImportSongs",
+				"subFunction": "next",
+			}).Errorf("error: %s", err.Error())
+			return finishReport(report), err
+		}
+		if err = ValidateSong(song); err != nil {
+			report.Rows = append(report.Rows, models.ImportRow{Row: rowNum, Status: ImportStatusInvalid, Error: err.Error()})
+			continue
+		}
+		batch[rowNum] = song
+		if len(batch) == importBatchSize {
+			if err = s.importBatch(ctx, batch, &report); err != nil {
+				return finishReport(report), err
+			}
+			batch = make(map[int]models.Song, importBatchSize)
+		}
+	}
+	if len(batch) != 0 {
+		if err := s.importBatch(ctx, batch, &report); err != nil {
+			return finishReport(report), err
+		}
+	}
+	report = finishReport(report)
+	s.logger.Debugf("imported created=%d skipped=%d invalid=%d", report.Created, report.Skipped, report.Invalid)
+	return report, nil
+}
+
+// finishReport counts the rows of the report by status and sorts them.
+func finishReport(report models.ImportReport) models.ImportReport {
+	for _, row := range report.Rows {
+		switch row.Status {
+		case ImportStatusCreated:
+			report.Created++
+		case ImportStatusDuplicate:
+			report.Skipped++
+		default:
+			report.Invalid++
+		}
+	}
+	slices.SortFunc(report.Rows, func(a, b models.ImportRow) int {
+		return a.Row - b.Row
+	})
+	return report
+}
+
+func (s *Service) importBatch(ctx context.Context, batch map[int]models.Song, report *models.ImportReport) error {
+	created, trashed, err := s.repo.ImportSongsDB(ctx, batch)
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "ImportSongs",
+			"subFunction": "ImportSongsDB",
+		}).Errorf("error: %s", err.Error())
+		return err
+	}
+	for rowNum := range batch {
+		if id, ok := created[rowNum]; ok {
+			report.Rows = append(report.Rows, models.ImportRow{Row: rowNum, Status: ImportStatusCreated, ID: id})
+		} else if id, ok := trashed[rowNum]; ok {
+			report.Rows = append(report.Rows, models.ImportRow{Row: rowNum, Status: ImportStatusDuplicate, ID: id, Error: postgres.ErrSongInTrash.Error()})
+		} else {
+			report.Rows = append(report.Rows, models.ImportRow{Row: rowNum, Status: ImportStatusDuplicate})
+		}
+	}
+	return nil
+}
+
+// rowError is a malformed row, it is reported and the import goes on.
+type rowError struct {
+	err error
+}
+
+func (e *rowError) Error() string {
+	return e.err.Error()
+}
+
+type csvSongReader struct {
+	reader  *csv.Reader
+	columns []string
+}
+
+func newCSVSongReader(r io.Reader) (*csvSongReader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if err == io.EOF || errors.As(err, &parseErr) {
+			return nil, invalidCSVHeader
+		}
+		return nil, err
+	}
+	columns := make([]string, len(header))
+	hasGroup, hasSong := false, false
+	for i, name := range header {
+		columns[i] = csvColumns[strings.ToLower(strings.TrimSpace(name))]
+		hasGroup = hasGroup || columns[i] == "group"
+		hasSong = hasSong || columns[i] == "song"
+	}
+	if !hasGroup || !hasSong {
+		return nil, invalidCSVHeader
+	}
+	return &csvSongReader{reader: reader, columns: columns}, nil
+}
+
+func (r *csvSongReader) next() (models.Song, error) {
+	record, err := r.reader.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return models.Song{}, &rowError{err}
+		}
+		return models.Song{}, err
+	}
+	song := models.Song{}
+	for i, value := range record {
+		if i >= len(r.columns) {
+			return models.Song{}, &rowError{fmt.Errorf("row has %d fields, header has %d", len(record), len(r.columns))}
+		}
+		switch r.columns[i] {
+		case "group":
+			song.Group = value
+		case "song":
+			song.Song = value
+		case "text":
+			song.Text = value
+		case "releaseDate":
+			song.ReleaseDate = value
+		case "link":
+			song.Link = value
+		}
+	}
+	return song, nil
+}
+
+type ndjsonSongReader struct {
+	reader *bufio.Reader
+}
+
+func newNDJSONSongReader(r io.Reader) *ndjsonSongReader {
+	return &ndjsonSongReader{reader: bufio.NewReader(r)}
+}
+
+// next decodes the next line, blank lines are skipped.
+func (r *ndjsonSongReader) next() (models.Song, error) {
+	for {
+		line, err := r.reader.ReadBytes('\n')
+		if err != nil && err != io.EOF {
+			return models.Song{}, err
+		}
+		if len(strings.TrimSpace(string(line))) == 0 {
+			if err == io.EOF {
+				return models.Song{}, io.EOF
+			}
+			continue
+		}
+		song := models.Song{}
+		if jsonErr := json.Unmarshal(line, &song); jsonErr != nil {
+			return models.Song{}, &rowError{jsonErr}
+		}
+		return song, nil
+	}
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"github.com/mao360/musicLib/models"
+	"github.com/mao360/musicLib/pkg/apperrors"
+	"github.com/mao360/musicLib/pkg/postgres"
+	"github.com/sirupsen/logrus"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	invalidPatchField = apperrors.New(apperrors.Validation, "field can't be patched")
+)
+
+// patchableFields are the models.Song JSON fields a merge patch may contain.
+var patchableFields = map[string]struct{}{
+	"group":       {},
+	"song":        {},
+	"text":        {},
+	"releaseDate": {},
+	"link":        {},
+}
+
+// PatchSongByID applies an RFC 7396 merge patch, a nil value standing for a
+// JSON null. Only the fields present are validated and updated, and only if
+// the song is still at version, zero skips the check.
+func (s *Service) PatchSongByID(ctx context.Context, songID string, version int, patch map[string]*string) (models.Song, error) {
+	id, err := strconv.Atoi(songID)
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "PatchSongByID",
+			"subFunction": "Atoi() songID",
+		}).Errorf("error: %s", err.Error())
+		return models.Song{}, invalidSongID
+	}
+	invalid := make([]apperrors.FieldError, 0)
+	for field, value := range patch {
+		if _, ok := patchableFields[field]; !ok {
+			invalid = append(invalid, apperrors.FieldError{Field: field, Message: invalidPatchField.Error()})
+			continue
+		}
+		if value == nil {
+			// group and song are NOT NULL, the other fields are cleared.
+			if field == "group" || field == "song" {
+				invalid = append(invalid, apperrors.FieldError{Field: field, Message: "is required"})
+			}
+			continue
+		}
+		if message := validateSongField(field, *value); message != "" {
+			invalid = append(invalid, apperrors.FieldError{Field: field, Message: message})
+		}
+	}
+	if len(invalid) != 0 {
+		// Map iteration order is random, keep the reported order stable.
+		slices.SortFunc(invalid, func(a, b apperrors.FieldError) int {
+			return strings.Compare(a.Field, b.Field)
+		})
+		err = apperrors.Invalid(invalid...)
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "PatchSongByID",
+			"subFunction": "validateSongField",
+		}).Errorf("error: %s", err.Error())
+		return models.Song{}, err
+	}
+
+	s.logger.Debugf("id=%d fields=%d", id, len(patch))
+	var patched models.Song
+	if len(patch) == 0 {
+		patched, err = s.repo.SearchSongByIDDB(ctx, id)
+		if err == nil && version != 0 && patched.Version != version {
+			err = postgres.ErrVersionMismatch
+		}
+	} else {
+		patched, err = s.repo.PatchSongByIDDB(ctx, id, version, patch)
+	}
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "PatchSongByID",
+			"subFunction": "PatchSongByIDDB",
+		}).Errorf("error: %s", err.Error())
+		return models.Song{}, err
+	}
+	return patched, nil
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"github.com/mao360/musicLib/pkg/apperrors"
+	"github.com/sirupsen/logrus"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	invalidDecade    = apperrors.Field("decade", "invalid decade")
+	futureDate       = apperrors.New(apperrors.Validation, "date is in the future")
+	invalidDateRange = apperrors.New(apperrors.Validation, "released_after is later than released_before")
+)
+
+// checkReleaseFilters validates the release date filters of GetSongsByFilter:
+// release_date and year take a year, decade a year divisible by ten with an
+// optional "s" suffix ("1990s"), released_after and released_before a
+// dd.mm.yyyy date. None of them may point to the future. A decade is
+// normalized to its first year.
+func (s *Service) checkReleaseFilters(filters map[string]string) error {
+	now := time.Now()
+	for _, key := range []string{"release_date", "year"} {
+		if year, ok := filters[key]; ok {
+			yearInt, err := strconv.Atoi(year)
+			if err != nil || yearInt <= 0 || yearInt > now.Year() {
+				s.logger.WithFields(logrus.Fields{
+					"layer":    "service",
+					"function": "checkReleaseFilters",
+				}).Errorf("error: %s", invalidYear.Error())
+				return invalidYear
+			}
+		}
+	}
+
+	if decade, ok := filters["decade"]; ok {
+		decadeInt, err := strconv.Atoi(strings.TrimSuffix(decade, "s"))
+		if err != nil || decadeInt <= 0 || decadeInt%10 != 0 || decadeInt > now.Year() {
+			s.logger.WithFields(logrus.Fields{
+				"layer":    "service",
+				"function": "checkReleaseFilters",
+			}).Errorf("error: %s", invalidDecade.Error())
+			return invalidDecade
+		}
+		filters["decade"] = strconv.Itoa(decadeInt)
+	}
+
+	dates := make(map[string]time.Time)
+	for _, key := range []string{"released_after", "released_before"} {
+		value, ok := filters[key]
+		if !ok {
+			continue
+		}
+		date, err := time.Parse("02.01.2006", value)
+		if err != nil || !CheckDate(value) {
+			s.logger.WithFields(logrus.Fields{
+				"layer":       "service",
+				"function":    "checkReleaseFilters",
+				"subFunction": "CheckDate",
+			}).Errorf("error: %s", invalidDate.Error())
+			return invalidDate
+		}
+		if date.After(now) {
+			s.logger.WithFields(logrus.Fields{
+				"layer":    "service",
+				"function": "checkReleaseFilters",
+			}).Errorf("error: %s", futureDate.Error())
+			return futureDate
+		}
+		dates[key] = date
+	}
+	after, hasAfter := dates["released_after"]
+	before, hasBefore := dates["released_before"]
+	if hasAfter && hasBefore && after.After(before) {
+		s.logger.WithFields(logrus.Fields{
+			"layer":    "service",
+			"function": "checkReleaseFilters",
+		}).Errorf("error: %s", invalidDateRange.Error())
+		return invalidDateRange
+	}
+	return nil
+}
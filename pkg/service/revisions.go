@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"github.com/mao360/musicLib/models"
+	"github.com/mao360/musicLib/pkg/apperrors"
+	"github.com/sirupsen/logrus"
+	"strconv"
+	"strings"
+)
+
+var invalidRevision = apperrors.Field("revision", "invalid revision")
+
+func (s *Service) GetSongRevisions(ctx context.Context, songID string) ([]models.SongRevision, error) {
+	id, err := strconv.Atoi(songID)
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "GetSongRevisions",
+			"subFunction": "Atoi() songID",
+		}).Errorf("error: %s", err.Error())
+		return nil, invalidSongID
+	}
+	revisions, err := s.repo.GetSongRevisionsDB(ctx, id)
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "GetSongRevisions",
+			"subFunction": "GetSongRevisionsDB",
+		}).Errorf("error: %s", err.Error())
+		return nil, err
+	}
+	s.logger.Debugf("len(revisions)=%d", len(revisions))
+	return revisions, nil
+}
+
+// DiffSongRevisions compares two revisions of a song field by field. Only the
+// changed fields are listed, a changed text comes with its line diff.
+func (s *Service) DiffSongRevisions(ctx context.Context, songID, from, to string) (models.SongDiff, error) {
+	id, err := strconv.Atoi(songID)
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "DiffSongRevisions",
+			"subFunction": "Atoi() songID",
+		}).Errorf("error: %s", err.Error())
+		return models.SongDiff{}, invalidSongID
+	}
+	fromRev, err := s.getRevision(ctx, id, from, "DiffSongRevisions")
+	if err != nil {
+		return models.SongDiff{}, err
+	}
+	toRev, err := s.getRevision(ctx, id, to, "DiffSongRevisions")
+	if err != nil {
+		return models.SongDiff{}, err
+	}
+
+	diff := models.SongDiff{SongID: id, From: fromRev.Revision, To: toRev.Revision, Changes: make([]models.FieldChange, 0)}
+	fields := []struct {
+		name     string
+		from, to string
+	}{
+		{"group", fromRev.Group, toRev.Group},
+		{"song", fromRev.Song, toRev.Song},
+		{"text", fromRev.Text, toRev.Text},
+		{"releaseDate", fromRev.ReleaseDate, toRev.ReleaseDate},
+		{"link", fromRev.Link, toRev.Link},
+	}
+	for _, field := range fields {
+		if field.from == field.to {
+			continue
+		}
+		change := models.FieldChange{Field: field.name, From: field.from, To: field.to}
+		if field.name == "text" {
+			change.Lines = lineDiff(field.from, field.to)
+		}
+		diff.Changes = append(diff.Changes, change)
+	}
+	s.logger.Debugf("changed fields=%d", len(diff.Changes))
+	return diff, nil
+}
+
+// RevertSong makes the song look like it did at the given revision. The
+// revert is an update of its own and adds a new revision, like any change it
+// is based on version.
+func (s *Service) RevertSong(ctx context.Context, songID, revision string, version int) (models.Song, error) {
+	id, err := strconv.Atoi(songID)
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "RevertSong",
+			"subFunction": "Atoi() songID",
+		}).Errorf("error: %s", err.Error())
+		return models.Song{}, invalidSongID
+	}
+	rev, err := s.getRevision(ctx, id, revision, "RevertSong")
+	if err != nil {
+		return models.Song{}, err
+	}
+	reverted, err := s.repo.ChangeSongByIDDB(ctx, id, version, models.Song{
+		Group:       rev.Group,
+		Song:        rev.Song,
+		Text:        rev.Text,
+		ReleaseDate: rev.ReleaseDate,
+		Link:        rev.Link,
+	})
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "RevertSong",
+			"subFunction": "ChangeSongByIDDB",
+		}).Errorf("error: %s", err.Error())
+		return models.Song{}, err
+	}
+	s.logger.Debugf("reverted id=%d to revision=%d", id, rev.Revision)
+	return reverted, nil
+}
+
+func (s *Service) getRevision(ctx context.Context, songID int, revision, function string) (models.SongRevision, error) {
+	revisionNum, err := strconv.Atoi(revision)
+	if err != nil || revisionNum <= 0 {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    function,
+			"subFunction": "Atoi() and revision > 0",
+		}).Errorf("error: %s", invalidRevision.Error())
+		return models.SongRevision{}, invalidRevision
+	}
+	rev, err := s.repo.GetSongRevisionDB(ctx, songID, revisionNum)
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    function,
+			"subFunction": "GetSongRevisionDB",
+		}).Errorf("error: %s", err.Error())
+		return models.SongRevision{}, err
+	}
+	return rev, nil
+}
+
+const (
+	LineEqual  = "equal"
+	LineDelete = "delete"
+	LineInsert = "insert"
+)
+
+// maxDiffCells bounds the LCS table of lineDiff. Texts whose differing lines
+// don't fit in it are diffed as one deleted and one inserted block.
+const maxDiffCells = 1 << 22
+
+// lineDiff returns the edit script turning the lines of from into the lines
+// of to. The common prefix and suffix are equal as they are, the lines in
+// between are matched by their longest common subsequence.
+func lineDiff(from, to string) []models.LineChange {
+	a, b := strings.Split(from, "\n"), strings.Split(to, "\n")
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	changes := make([]models.LineChange, 0, max(len(a), len(b)))
+	for _, line := range a[:prefix] {
+		changes = append(changes, models.LineChange{Op: LineEqual, Text: line})
+	}
+	changes = append(changes, middleDiff(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		changes = append(changes, models.LineChange{Op: LineEqual, Text: line})
+	}
+	return changes
+}
+
+// middleDiff diffs the lines between the common prefix and suffix.
+func middleDiff(a, b []string) []models.LineChange {
+	changes := make([]models.LineChange, 0, len(a)+len(b))
+	if (len(a)+1)*(len(b)+1) > maxDiffCells {
+		for _, line := range a {
+			changes = append(changes, models.LineChange{Op: LineDelete, Text: line})
+		}
+		for _, line := range b {
+			changes = append(changes, models.LineChange{Op: LineInsert, Text: line})
+		}
+		return changes
+	}
+	// lcs[i*width+j] is the LCS length of a[i:] and b[j:].
+	width := len(b) + 1
+	lcs := make([]int32, (len(a)+1)*width)
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i*width+j] = lcs[(i+1)*width+j+1] + 1
+			} else {
+				lcs[i*width+j] = max(lcs[(i+1)*width+j], lcs[i*width+j+1])
+			}
+		}
+	}
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			changes = append(changes, models.LineChange{Op: LineEqual, Text: a[i]})
+			i++
+			j++
+		case lcs[(i+1)*width+j] >= lcs[i*width+j+1]:
+			changes = append(changes, models.LineChange{Op: LineDelete, Text: a[i]})
+			i++
+		default:
+			changes = append(changes, models.LineChange{Op: LineInsert, Text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		changes = append(changes, models.LineChange{Op: LineDelete, Text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		changes = append(changes, models.LineChange{Op: LineInsert, Text: b[j]})
+	}
+	return changes
+}
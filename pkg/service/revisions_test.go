@@ -0,0 +1,100 @@
+package service
+
+import (
+	"github.com/mao360/musicLib/models"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func eq(text string) models.LineChange  { return models.LineChange{Op: LineEqual, Text: text} }
+func del(text string) models.LineChange { return models.LineChange{Op: LineDelete, Text: text} }
+func ins(text string) models.LineChange { return models.LineChange{Op: LineInsert, Text: text} }
+
+func TestLineDiff(t *testing.T) {
+	tests := []struct {
+		name     string
+		from, to string
+		want     []models.LineChange
+	}{
+		{
+			name: "identical",
+			from: "a\nb\nc",
+			to:   "a\nb\nc",
+			want: []models.LineChange{eq("a"), eq("b"), eq("c")},
+		},
+		{
+			name: "insert in the middle",
+			from: "a\nc",
+			to:   "a\nb\nc",
+			want: []models.LineChange{eq("a"), ins("b"), eq("c")},
+		},
+		{
+			name: "insert at the end",
+			from: "a",
+			to:   "a\nb\nc",
+			want: []models.LineChange{eq("a"), ins("b"), ins("c")},
+		},
+		{
+			name: "delete at the start",
+			from: "a\nb\nc",
+			to:   "c",
+			want: []models.LineChange{del("a"), del("b"), eq("c")},
+		},
+		{
+			name: "change between a common prefix and suffix",
+			from: "a\nx\ny\nz",
+			to:   "a\nq\ny\nz",
+			want: []models.LineChange{eq("a"), del("x"), ins("q"), eq("y"), eq("z")},
+		},
+		{
+			name: "common lines inside the changed middle",
+			from: "a\nb\nc\nd",
+			to:   "x\nb\nd\ny",
+			want: []models.LineChange{del("a"), ins("x"), eq("b"), del("c"), eq("d"), ins("y")},
+		},
+		{
+			name: "empty to text",
+			from: "",
+			to:   "a",
+			want: []models.LineChange{del(""), ins("a")},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := lineDiff(tt.from, tt.to)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("lineDiff(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+// TestLineDiffOverCap checks that texts whose differing lines don't fit the
+// LCS table are diffed as one deleted and one inserted block, the common
+// prefix and suffix still equal.
+func TestLineDiffOverCap(t *testing.T) {
+	const lines = 3000 // 3001*3001 cells is over maxDiffCells
+	if (lines+1)*(lines+1) <= maxDiffCells {
+		t.Fatalf("%d lines fit the LCS table, raise them", lines)
+	}
+	from := "head\n" + strings.Repeat("x\n", lines) + "tail"
+	to := "head\n" + strings.Repeat("y\n", lines) + "tail"
+
+	got := lineDiff(from, to)
+	if len(got) != 2*lines+2 {
+		t.Fatalf("got %d changes, want %d", len(got), 2*lines+2)
+	}
+	if got[0] != eq("head") || got[len(got)-1] != eq("tail") {
+		t.Errorf("prefix and suffix: got %v and %v", got[0], got[len(got)-1])
+	}
+	for i, change := range got[1 : len(got)-1] {
+		want := del("x")
+		if i >= lines {
+			want = ins("y")
+		}
+		if change != want {
+			t.Fatalf("change %d = %v, want %v", i+1, change, want)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"github.com/mao360/musicLib/models"
+	"github.com/mao360/musicLib/pkg/apperrors"
+	"github.com/sirupsen/logrus"
+	"strconv"
+	"strings"
+)
+
+var (
+	emptySearchQuery      = apperrors.Field("q", "empty search query")
+	invalidSearchLanguage = apperrors.Field("lang", "invalid search language")
+)
+
+// searchConfigs maps accepted lang values to postgres text search configurations.
+var searchConfigs = map[string]string{
+	"ru":      "russian",
+	"russian": "russian",
+	"en":      "english",
+	"english": "english",
+}
+
+// SearchConfig resolves lang to a postgres text search configuration.
+func SearchConfig(lang string) (string, bool) {
+	config, ok := searchConfigs[strings.ToLower(lang)]
+	return config, ok
+}
+
+func (s *Service) SearchSongs(ctx context.Context, query, lang, pageSize, page string) (models.Page, error) {
+	s.logger.Debugf("query=%s lang=%s pageSize=%s page=%s", query, lang, pageSize, page)
+	query = strings.TrimSpace(query)
+	if query == "" {
+		s.logger.WithFields(logrus.Fields{
+			"layer":    "service",
+			"function": "SearchSongs",
+		}).Errorf("error: %s", emptySearchQuery.Error())
+		return models.Page{}, emptySearchQuery
+	}
+	config := s.searchConfig
+	if lang != "" {
+		var ok bool
+		if config, ok = SearchConfig(lang); !ok {
+			s.logger.WithFields(logrus.Fields{
+				"layer":       "service",
+				"function":    "SearchSongs",
+				"subFunction": "SearchConfig",
+			}).Errorf("error: %s", invalidSearchLanguage.Error())
+			return models.Page{}, invalidSearchLanguage
+		}
+	}
+	pageNum, err := strconv.Atoi(page)
+	if err != nil || pageNum <= 0 {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "SearchSongs",
+			"subFunction": "Atoi() and page > 0",
+		}).Errorf("error: %s", invalidPage.Error())
+		return models.Page{}, invalidPage
+	}
+	limit, err := strconv.Atoi(pageSize)
+	if err != nil || limit <= 0 {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "SearchSongs",
+			"subFunction": "Atoi() and pageSize > 0",
+		}).Errorf("error: %s", invalidPageSize.Error())
+		return models.Page{}, invalidPageSize
+	}
+	offset := (pageNum - 1) * limit
+
+	total, err := s.repo.CountSearchSongsDB(ctx, query, config)
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "SearchSongs",
+			"subFunction": "CountSearchSongsDB",
+		}).Errorf("error: %s", err.Error())
+		return models.Page{}, err
+	}
+	results, err := s.repo.SearchSongsDB(ctx, query, config, limit, offset)
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "SearchSongs",
+			"subFunction": "SearchSongsDB",
+		}).Errorf("error: %s", err.Error())
+		return models.Page{}, err
+	}
+	s.logger.Debugf("len(results)=%d total=%d", len(results), total)
+	return models.Page{Items: results, Total: total, Page: pageNum, PageSize: limit}, nil
+}
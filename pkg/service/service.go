@@ -1,11 +1,14 @@
 package service
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"github.com/mao360/musicLib/models"
+	"github.com/mao360/musicLib/pkg/apperrors"
 	"github.com/mao360/musicLib/pkg/postgres"
+	"github.com/mao360/musicLib/pkg/songinfo"
 	"github.com/sirupsen/logrus"
+	"io"
 	"net/url"
 	"strconv"
 	"strings"
@@ -13,42 +16,85 @@ import (
 )
 
 var (
-	invalidDate     = errors.New("invalid date")
-	invalidLink     = errors.New("invalid link")
-	noText          = errors.New("no text at this page")
-	invalidPage     = errors.New("invalid page")
-	invalidPageSize = errors.New("invalid page size")
-	invalidYear     = errors.New("invalid year")
+	invalidDate     = apperrors.Field("releaseDate", "invalid date")
+	invalidLink     = apperrors.Field("link", "invalid link")
+	noText          = apperrors.New(apperrors.NotFound, "no text at this page")
+	invalidPage     = apperrors.Field("page", "invalid page")
+	invalidPageSize = apperrors.Field("pageSize", "invalid page size")
+	invalidYear     = apperrors.Field("year", "invalid year")
+	invalidSongID   = apperrors.New(apperrors.Validation, "invalid song id")
+	invalidArtistID = apperrors.New(apperrors.Validation, "invalid artist id")
+	invalidAlbumID  = apperrors.New(apperrors.Validation, "invalid album id")
+	invalidMatch    = apperrors.New(apperrors.Validation, "invalid match mode")
+	fuzzyWithCursor = apperrors.New(apperrors.Validation, "fuzzy matching can't be used with cursor pagination")
 )
 
 type ServiceInterface interface {
-	GetSongsByFilter(filters map[string]string, limit, offset string) ([]models.Song, error)
-	GetTextByID(songID, limit, offset string) (string, error)
-	DeleteSongByID(songID string) error
-	ChangeSongByID(songID string, song models.Song) error
-	AddSong(song models.Song) error
+	GetSongsByFilter(ctx context.Context, filters, matches map[string]string, sort, limit, offset, cursor string) (models.Page, error)
+	GetTextByID(ctx context.Context, songID, limit, offset string) (models.SongText, error)
+	DeleteSongByID(ctx context.Context, songID string, version int) error
+	ChangeSongByID(ctx context.Context, songID string, version int, song models.Song) (models.Song, error)
+	PatchSongByID(ctx context.Context, songID string, version int, patch map[string]*string) (models.Song, error)
+	AddSong(ctx context.Context, song models.Song) (models.Song, error)
+	AddPendingSong(ctx context.Context, song models.Song) (models.Song, error)
+	ImportSongs(ctx context.Context, r io.Reader, format string) (models.ImportReport, error)
+	ExportSongs(ctx context.Context, filters, matches map[string]string, sort string, fn func(models.Song) error) error
+
+	GetSongRevisions(ctx context.Context, songID string) ([]models.SongRevision, error)
+	DiffSongRevisions(ctx context.Context, songID, from, to string) (models.SongDiff, error)
+	RevertSong(ctx context.Context, songID, revision string, version int) (models.Song, error)
+
+	GetTrash(ctx context.Context, pageSize, page string) (models.Page, error)
+	RestoreSongByID(ctx context.Context, songID string) (models.Song, error)
+	PurgeSongByID(ctx context.Context, songID string) error
+
+	GetDeadEnrichmentJobs(ctx context.Context, pageSize, page string) (models.Page, error)
+	RequeueEnrichmentJob(ctx context.Context, jobID string) (models.EnrichmentJob, error)
+
+	GetArtists(ctx context.Context, pageSize, page string) (models.Page, error)
+	GetArtistByID(ctx context.Context, artistID string) (models.Artist, error)
+	AddArtist(ctx context.Context, artist models.Artist) (models.Artist, error)
+	RenameArtistByID(ctx context.Context, artistID string, artist models.Artist) (models.Artist, error)
+	DeleteArtistByID(ctx context.Context, artistID, policy string) error
+
+	GetAlbumByID(ctx context.Context, albumID string) (models.Album, error)
+	AddAlbum(ctx context.Context, album models.Album) (models.Album, error)
+	GetAlbumTracks(ctx context.Context, albumID string) ([]models.Track, error)
+	AttachTrack(ctx context.Context, albumID string, track models.TrackAttach) error
+	ReorderTracks(ctx context.Context, albumID string, order models.TrackOrder) error
+
+	SearchSongs(ctx context.Context, query, lang, pageSize, page string) (models.Page, error)
 }
 
 type Service struct {
-	repo   postgres.DBInterface
-	logger *logrus.Logger
+	repo           postgres.DBInterface
+	logger         *logrus.Logger
+	searchConfig   string
+	trashRetention time.Duration
+	songInfo       songinfo.ClientInterface
+	enrichment     EnrichmentConfig
 }
 
-func NewService(repo postgres.DBInterface, logger *logrus.Logger) *Service {
-	return &Service{repo, logger}
+func NewService(repo postgres.DBInterface, logger *logrus.Logger, searchConfig string, trashRetention time.Duration,
+	songInfo songinfo.ClientInterface, enrichment EnrichmentConfig) *Service {
+	return &Service{repo, logger, searchConfig, trashRetention, songInfo, enrichment}
 }
 
-func (s *Service) GetSongsByFilter(filters map[string]string, pageSize, page string) ([]models.Song, error) {
-	s.logger.Debugf("pageSize=%s, page=%s", pageSize, page)
-	offset, err := strconv.Atoi(page)
-	if err != nil || offset <= 0 {
-		s.logger.WithFields(logrus.Fields{
-			"layer":       "service",
-			"function":    "GetSongsByFilter",
-			"subFunction": "Atoi() and page > 0",
-		}).Errorf("error: %s", invalidPage.Error())
-		return nil, invalidPage
-	}
+// matchableFilters are the filters that accept a match mode.
+var matchableFilters = map[string]struct{}{
+	"group_name": {},
+	"song_name":  {},
+}
+
+// GetSongsByFilter returns a page of songs. matches selects per filter how its
+// value is compared: exact (default), contains or fuzzy.
+//
+// A page number selects offset pagination. Without it the songs are paged by
+// keyset: cursor is empty for the first page or one of the cursors returned
+// with a previous page for the same sort. Fuzzy matching has no stable keyset,
+// so without page and cursor it falls back to the first offset page.
+func (s *Service) GetSongsByFilter(ctx context.Context, filters, matches map[string]string, sort, pageSize, page, cursor string) (models.Page, error) {
+	s.logger.Debugf("sort=%s, pageSize=%s, page=%s, cursor=%s", sort, pageSize, page, cursor)
 	limit, err := strconv.Atoi(pageSize)
 	if err != nil || limit <= 0 {
 		s.logger.WithFields(logrus.Fields{
@@ -56,10 +102,93 @@ func (s *Service) GetSongsByFilter(filters map[string]string, pageSize, page str
 			"function":    "GetSongsByFilter",
 			"subFunction": "Atoi() and pageSize > 0",
 		}).Errorf("error: %s", invalidPageSize.Error())
-		return nil, invalidPageSize
+		return models.Page{}, invalidPageSize
+	}
+	sortFields, err := ParseSort(sort)
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "GetSongsByFilter",
+			"subFunction": "ParseSort",
+		}).Errorf("error: %s", err.Error())
+		return models.Page{}, err
+	}
+	if page == "" && cursor == "" && hasFuzzyMatch(matches) {
+		page = "1"
+	}
+	var pageNum, offset int
+	var keyset *models.Cursor
+	if page != "" {
+		pageNum, err = strconv.Atoi(page)
+		if err != nil || pageNum <= 0 {
+			s.logger.WithFields(logrus.Fields{
+				"layer":       "service",
+				"function":    "GetSongsByFilter",
+				"subFunction": "Atoi() and page > 0",
+			}).Errorf("error: %s", invalidPage.Error())
+			return models.Page{}, invalidPage
+		}
+		offset = (pageNum - 1) * limit
+	} else {
+		keyset = &models.Cursor{Sort: formatSort(sortFields)}
+		if cursor != "" {
+			decoded, err := DecodeCursor(cursor)
+			if err == nil && decoded.Sort != keyset.Sort {
+				err = invalidCursor
+			}
+			if err != nil {
+				s.logger.WithFields(logrus.Fields{
+					"layer":       "service",
+					"function":    "GetSongsByFilter",
+					"subFunction": "DecodeCursor",
+				}).Errorf("error: %s", err.Error())
+				return models.Page{}, err
+			}
+			keyset = &decoded
+		}
 	}
-	offset = (offset - 1) * limit
 
+	if err = s.checkSongFilters(filters, matches, "GetSongsByFilter"); err != nil {
+		return models.Page{}, err
+	}
+	if keyset != nil && hasFuzzyMatch(matches) {
+		s.logger.WithFields(logrus.Fields{
+			"layer":    "service",
+			"function": "GetSongsByFilter",
+		}).Errorf("error: %s", fuzzyWithCursor.Error())
+		return models.Page{}, fuzzyWithCursor
+	}
+
+	total, err := s.repo.CountSongsByFilterDB(ctx, filters, matches)
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "GetSongsByFilter",
+			"subFunction": "CountSongsByFilterDB",
+		}).Errorf("error: %s", err.Error())
+		return models.Page{}, err
+	}
+	if keyset != nil {
+		return s.getSongsByCursor(ctx, filters, matches, sortFields, limit, total, *keyset)
+	}
+
+	s.logger.Debugf("len(filters)=%d matches=%v limit=%d offset=%d", len(filters), matches, limit, offset)
+	songs, err := s.repo.GetSongsByFilterDB(ctx, filters, matches, sortFields, limit, offset, nil)
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "GetSongsByFilter",
+			"subFunction": "GetSongsByFilterDB",
+		}).Errorf("error: %s", err.Error())
+		return models.Page{}, err
+	}
+	s.logger.Debugf("len(songs)=%d total=%d", len(songs), total)
+	return models.Page{Items: songs, Total: total, Page: pageNum, PageSize: limit}, nil
+}
+
+// checkSongFilters drops the empty filters and match modes and validates the
+// rest, function names the caller in the log.
+func (s *Service) checkSongFilters(filters, matches map[string]string, function string) error {
 	for k, v := range filters {
 		if v == "" {
 			delete(filters, k)
@@ -67,39 +196,118 @@ func (s *Service) GetSongsByFilter(filters map[string]string, pageSize, page str
 	}
 	s.logger.Debugf("len(filters)=%d", len(filters))
 
-	if year, ok := filters["release_date"]; ok {
-		yearInt, err := strconv.Atoi(year)
-		if err != nil || yearInt > time.Now().Year() {
+	if err := s.checkReleaseFilters(filters); err != nil {
+		return err
+	}
+
+	if artistID, ok := filters["artist_id"]; ok {
+		if id, err := strconv.Atoi(artistID); err != nil || id <= 0 {
 			s.logger.WithFields(logrus.Fields{
 				"layer":    "service",
-				"function": "GetSongsByFilter",
-			}).Errorf("error: %s", invalidYear.Error())
-			return nil, invalidYear
+				"function": function,
+			}).Errorf("error: %s", invalidArtistID.Error())
+			return invalidArtistID
+		}
+	}
+
+	if albumID, ok := filters["album_id"]; ok {
+		if id, err := strconv.Atoi(albumID); err != nil || id <= 0 {
+			s.logger.WithFields(logrus.Fields{
+				"layer":    "service",
+				"function": function,
+			}).Errorf("error: %s", invalidAlbumID.Error())
+			return invalidAlbumID
+		}
+	}
+
+	for k, v := range matches {
+		if v == "" {
+			delete(matches, k)
+			continue
+		}
+		_, matchable := matchableFilters[k]
+		if !matchable || (v != postgres.MatchExact && v != postgres.MatchContains && v != postgres.MatchFuzzy) {
+			s.logger.WithFields(logrus.Fields{
+				"layer":    "service",
+				"function": function,
+			}).Errorf("error: %s", invalidMatch.Error())
+			return invalidMatch
 		}
 	}
 
 	if link, ok := filters["link"]; ok && !CheckLink(link) {
 		s.logger.WithFields(logrus.Fields{
 			"layer":    "service",
-			"function": "GetSongsByFilter",
+			"function": function,
 		}).Errorf("error: %s", invalidLink.Error())
-		return nil, invalidLink
+		return invalidLink
 	}
-	s.logger.Debugf("len(filters)=%d limit=%d offset=%d", len(filters), limit, offset)
-	songs, err := s.repo.GetSongsByFilterDB(filters, limit, offset)
+	return nil
+}
+
+func hasFuzzyMatch(matches map[string]string) bool {
+	for _, match := range matches {
+		if match == postgres.MatchFuzzy {
+			return true
+		}
+	}
+	return false
+}
+
+// getSongsByCursor fetches one song more than limit to find out whether
+// there is a page beyond the requested one.
+func (s *Service) getSongsByCursor(ctx context.Context, filters, matches map[string]string, sort []models.SortField, limit, total int, cursor models.Cursor) (models.Page, error) {
+	s.logger.Debugf("len(filters)=%d matches=%v sort=%v limit=%d cursor=%v", len(filters), matches, sort, limit, cursor)
+	songs, err := s.repo.GetSongsByFilterDB(ctx, filters, matches, sort, limit+1, 0, &cursor)
 	if err != nil {
 		s.logger.WithFields(logrus.Fields{
 			"layer":       "service",
-			"function":    "GetSongsByFilter",
+			"function":    "getSongsByCursor",
 			"subFunction": "GetSongsByFilterDB",
 		}).Errorf("error: %s", err.Error())
-		return nil, nil
+		return models.Page{}, err
 	}
-	s.logger.Debugf("len(songs)=%d", len(songs))
-	return songs, nil
+	more := len(songs) > limit
+	if more {
+		if cursor.Backward {
+			songs = songs[1:]
+		} else {
+			songs = songs[:limit]
+		}
+	}
+	page := models.Page{Items: songs, Total: total, PageSize: limit}
+	if len(songs) == 0 {
+		return page, nil
+	}
+	order := postgres.SongsOrder(sort)
+	next := models.Cursor{Keys: songKeys(songs[len(songs)-1], order), Sort: cursor.Sort}
+	prev := models.Cursor{Keys: songKeys(songs[0], order), Sort: cursor.Sort, Backward: true}
+	if cursor.Backward {
+		page.NextCursor = EncodeCursor(next)
+		if more {
+			page.PrevCursor = EncodeCursor(prev)
+		}
+	} else {
+		if more {
+			page.NextCursor = EncodeCursor(next)
+		}
+		if len(cursor.Keys) != 0 {
+			page.PrevCursor = EncodeCursor(prev)
+		}
+	}
+	s.logger.Debugf("len(songs)=%d next=%s prev=%s", len(songs), page.NextCursor, page.PrevCursor)
+	return page, nil
+}
+
+func songKeys(song models.Song, order []models.SortField) []string {
+	keys := make([]string, 0, len(order))
+	for _, field := range order {
+		keys = append(keys, postgres.SortKey(song, field.Field))
+	}
+	return keys
 }
 
-func (s *Service) GetTextByID(songID, pageSize, page string) (string, error) {
+func (s *Service) GetTextByID(ctx context.Context, songID, pageSize, page string) (models.SongText, error) {
 	pageSizeInt, err := strconv.Atoi(pageSize)
 	if err != nil || pageSizeInt <= 0 {
 		s.logger.WithFields(logrus.Fields{
@@ -107,7 +315,7 @@ func (s *Service) GetTextByID(songID, pageSize, page string) (string, error) {
 			"function":    "GetTextByID",
 			"subFunction": "Atoi() and pageSize > 0",
 		}).Errorf("error: %s", invalidPageSize.Error())
-		return "", invalidPageSize
+		return models.SongText{}, invalidPageSize
 	}
 	pageInt, err := strconv.Atoi(page)
 	if err != nil || pageInt <= 0 {
@@ -116,7 +324,7 @@ func (s *Service) GetTextByID(songID, pageSize, page string) (string, error) {
 			"function":    "GetTextByID",
 			"subFunction": "Atoi() and page > 0",
 		}).Errorf("error: %s", invalidPage.Error())
-		return "", invalidPage
+		return models.SongText{}, invalidPage
 	}
 
 	id, err := strconv.Atoi(songID)
@@ -126,17 +334,17 @@ func (s *Service) GetTextByID(songID, pageSize, page string) (string, error) {
 			"function":    "GetTextByID",
 			"subFunction": "Atoi() songID",
 		}).Errorf("error: %s", err.Error())
-		return "", err
+		return models.SongText{}, invalidSongID
 	}
 	s.logger.Debugf("id=%d size=%d page=%d", id, pageSizeInt, pageInt)
-	song, err := s.repo.SearchSongByIDDB(id)
+	song, err := s.repo.SearchSongByIDDB(ctx, id)
 	if err != nil {
 		s.logger.WithFields(logrus.Fields{
 			"layer":       "service",
 			"function":    "GetTextByID",
 			"subFunction": "SearchSongByIDDB",
 		}).Errorf("error: %s", err.Error())
-		return "", err
+		return models.SongText{}, err
 	}
 	s.logger.Debugf("song=%v pageSize=%d page=%d", song, pageSizeInt, pageInt)
 	text := GetTextByPage(song.Text, pageSizeInt, pageInt)
@@ -147,12 +355,14 @@ func (s *Service) GetTextByID(songID, pageSize, page string) (string, error) {
 			"function":    "GetTextByID",
 			"subFunction": "GetTextByPage",
 		}).Errorf("error: %s", noText.Error())
-		return "", noText
+		return models.SongText{}, noText
 	}
-	return text, nil
+	return models.SongText{ID: song.ID, Text: text, Version: song.Version, UpdatedAt: song.UpdatedAt}, nil
 }
 
-func (s *Service) DeleteSongByID(songID string) error {
+// DeleteSongByID moves the song to the trash if it is still at version, zero
+// skips the check.
+func (s *Service) DeleteSongByID(ctx context.Context, songID string, version int) error {
 	id, err := strconv.Atoi(songID)
 	if err != nil {
 		s.logger.WithFields(logrus.Fields{
@@ -160,10 +370,10 @@ func (s *Service) DeleteSongByID(songID string) error {
 			"function":    "DeleteSongByID",
 			"subFunction": "Atoi() songID",
 		}).Errorf("error: %s", err.Error())
-		return err
+		return invalidSongID
 	}
 	s.logger.Debugf("id=%d", id)
-	if err = s.repo.DeleteSongByIDDB(id); err != nil {
+	if err = s.repo.DeleteSongByIDDB(ctx, id, version); err != nil {
 		s.logger.WithFields(logrus.Fields{
 			"layer":       "service",
 			"function":    "DeleteSongByID",
@@ -174,7 +384,9 @@ func (s *Service) DeleteSongByID(songID string) error {
 	return nil
 }
 
-func (s *Service) ChangeSongByID(songID string, song models.Song) error {
+// ChangeSongByID replaces the song if it is still at version, zero skips the
+// check.
+func (s *Service) ChangeSongByID(ctx context.Context, songID string, version int, song models.Song) (models.Song, error) {
 	id, err := strconv.Atoi(songID)
 	if err != nil {
 		s.logger.WithFields(logrus.Fields{
@@ -182,63 +394,50 @@ func (s *Service) ChangeSongByID(songID string, song models.Song) error {
 			"function":    "ChangeSongByID",
 			"subFunction": "Atoi() songID",
 		}).Errorf("error: %s", err.Error())
-		return err
+		return models.Song{}, invalidSongID
 	}
-	if !CheckDate(song.ReleaseDate) {
+	if err := ValidateSong(song); err != nil {
 		s.logger.WithFields(logrus.Fields{
 			"layer":       "service",
 			"function":    "ChangeSongByID",
-			"subFunction": "CheckDate",
-		}).Errorf("error: %s", invalidDate.Error())
-		return invalidDate
-	}
-	if !CheckLink(song.Link) {
-		s.logger.WithFields(logrus.Fields{
-			"layer":       "service",
-			"function":    "ChangeSongByID",
-			"subFunction": "CheckLink",
-		}).Errorf("error: %s", invalidLink.Error())
-		return invalidLink
+			"subFunction": "ValidateSong",
+		}).Errorf("error: %s", err.Error())
+		return models.Song{}, err
 	}
 	s.logger.Debugf("id=%d song=%s group=%s link=%s release=%s", id, song.Song, song.Group, song.Link, song.ReleaseDate)
-	if err = s.repo.ChangeSongByIDDB(id, song); err != nil {
+	changed, err := s.repo.ChangeSongByIDDB(ctx, id, version, song)
+	if err != nil {
 		s.logger.WithFields(logrus.Fields{
 			"layer":       "service",
 			"function":    "ChangeSongByID",
 			"subFunction": "ChangeSongByIDDB",
 		}).Errorf("error: %s", err.Error())
-		return err
+		return models.Song{}, err
 	}
-	return nil
+	return changed, nil
 }
 
-func (s *Service) AddSong(song models.Song) error {
-	if !CheckDate(song.ReleaseDate) {
-		s.logger.WithFields(logrus.Fields{
-			"layer":       "service",
-			"function":    "AddSong",
-			"subFunction": "CheckDate",
-		}).Errorf("error: %s", invalidDate.Error())
-		return invalidDate
-	}
-	if !CheckLink(song.Link) {
+func (s *Service) AddSong(ctx context.Context, song models.Song) (models.Song, error) {
+	if err := ValidateSong(song); err != nil {
 		s.logger.WithFields(logrus.Fields{
 			"layer":       "service",
 			"function":    "AddSong",
-			"subFunction": "CheckLink",
-		}).Errorf("error: %s", invalidLink.Error())
-		return invalidLink
+			"subFunction": "ValidateSong",
+		}).Errorf("error: %s", err.Error())
+		return models.Song{}, err
 	}
 	s.logger.Debugf("song=%s group=%s text=%s link=%s release=%s", song.Song, song.Group, song.Text, song.Link, song.ReleaseDate)
-	if err := s.repo.AddSongDB(song); err != nil {
+	created, err := s.repo.AddSongDB(ctx, song)
+	if err != nil {
 		s.logger.WithFields(logrus.Fields{
 			"layer":       "service",
 			"function":    "AddSong",
 			"subFunction": "AddSongDB",
 		}).Errorf("error: %s", err.Error())
-		return err
+		return models.Song{}, err
 	}
-	return nil
+	s.logger.Debugf("created id=%d", created.ID)
+	return created, nil
 }
 
 func CheckDate(date string) bool {
@@ -258,7 +457,8 @@ func CheckLink(link string) bool {
 	if err != nil {
 		return false
 	}
-	return parseURL.Scheme != "" && parseURL.Host != ""
+	_, allowed := allowedLinkSchemes[parseURL.Scheme]
+	return allowed && parseURL.Host != ""
 }
 
 func GetTextByPage(text string, pageSize, page int) string {
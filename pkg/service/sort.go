@@ -0,0 +1,60 @@
+package service
+
+import (
+	"github.com/mao360/musicLib/models"
+	"github.com/mao360/musicLib/pkg/apperrors"
+	"strings"
+)
+
+var invalidSort = apperrors.Field("sort", "invalid sort")
+
+// sortableFields are the song fields GET /songs can be sorted by.
+var sortableFields = map[string]struct{}{
+	"id":           {},
+	"group_name":   {},
+	"song_name":    {},
+	"release_date": {},
+	"link":         {},
+	"created_at":   {},
+	"updated_at":   {},
+}
+
+// ParseSort parses a comma separated list of fields, each optionally prefixed
+// with "-" for descending or "+" for ascending order, e.g. "-release_date,group_name".
+func ParseSort(sort string) ([]models.SortField, error) {
+	fields := make([]models.SortField, 0)
+	if strings.TrimSpace(sort) == "" {
+		return fields, nil
+	}
+	seen := make(map[string]struct{})
+	for _, part := range strings.Split(sort, ",") {
+		part = strings.TrimSpace(part)
+		field := models.SortField{Field: strings.TrimLeft(part, "+-")}
+		field.Desc = strings.HasPrefix(part, "-")
+		if len(part)-len(field.Field) > 1 {
+			return nil, invalidSort
+		}
+		if _, ok := sortableFields[field.Field]; !ok {
+			return nil, invalidSort
+		}
+		if _, ok := seen[field.Field]; ok {
+			return nil, invalidSort
+		}
+		seen[field.Field] = struct{}{}
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// formatSort is the canonical form of parsed sort fields, stored in cursors.
+func formatSort(fields []models.SortField) string {
+	parts := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if field.Desc {
+			parts = append(parts, "-"+field.Field)
+		} else {
+			parts = append(parts, field.Field)
+		}
+	}
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"context"
+	"github.com/mao360/musicLib/models"
+	"github.com/sirupsen/logrus"
+	"strconv"
+	"time"
+)
+
+// GetTrash returns a page of the deleted songs with the time each one is
+// purged at, when a retention window is set.
+func (s *Service) GetTrash(ctx context.Context, pageSize, page string) (models.Page, error) {
+	s.logger.Debugf("pageSize=%s, page=%s", pageSize, page)
+	pageNum, err := strconv.Atoi(page)
+	if err != nil || pageNum <= 0 {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "GetTrash",
+			"subFunction": "Atoi() and page > 0",
+		}).Errorf("error: %s", invalidPage.Error())
+		return models.Page{}, invalidPage
+	}
+	limit, err := strconv.Atoi(pageSize)
+	if err != nil || limit <= 0 {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "GetTrash",
+			"subFunction": "Atoi() and pageSize > 0",
+		}).Errorf("error: %s", invalidPageSize.Error())
+		return models.Page{}, invalidPageSize
+	}
+	offset := (pageNum - 1) * limit
+
+	total, err := s.repo.CountTrashDB(ctx)
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "GetTrash",
+			"subFunction": "CountTrashDB",
+		}).Errorf("error: %s", err.Error())
+		return models.Page{}, err
+	}
+	songs, err := s.repo.GetTrashDB(ctx, limit, offset)
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "GetTrash",
+			"subFunction": "GetTrashDB",
+		}).Errorf("error: %s", err.Error())
+		return models.Page{}, err
+	}
+	if s.trashRetention > 0 {
+		for i := range songs {
+			purgeAt := songs[i].DeletedAt.Add(s.trashRetention)
+			songs[i].PurgeAt = &purgeAt
+		}
+	}
+	s.logger.Debugf("len(songs)=%d total=%d", len(songs), total)
+	return models.Page{Items: songs, Total: total, Page: pageNum, PageSize: limit}, nil
+}
+
+func (s *Service) RestoreSongByID(ctx context.Context, songID string) (models.Song, error) {
+	id, err := strconv.Atoi(songID)
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "RestoreSongByID",
+			"subFunction": "Atoi() songID",
+		}).Errorf("error: %s", err.Error())
+		return models.Song{}, invalidSongID
+	}
+	s.logger.Debugf("id=%d", id)
+	restored, err := s.repo.RestoreSongByIDDB(ctx, id)
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "RestoreSongByID",
+			"subFunction": "RestoreSongByIDDB",
+		}).Errorf("error: %s", err.Error())
+		return models.Song{}, err
+	}
+	return restored, nil
+}
+
+func (s *Service) PurgeSongByID(ctx context.Context, songID string) error {
+	id, err := strconv.Atoi(songID)
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "PurgeSongByID",
+			"subFunction": "Atoi() songID",
+		}).Errorf("error: %s", err.Error())
+		return invalidSongID
+	}
+	s.logger.Debugf("id=%d", id)
+	if err = s.repo.PurgeSongByIDDB(ctx, id); err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "PurgeSongByID",
+			"subFunction": "PurgeSongByIDDB",
+		}).Errorf("error: %s", err.Error())
+		return err
+	}
+	return nil
+}
+
+// PurgeExpiredTrash deletes the songs that have been in the trash longer
+// than the retention window. A zero window keeps them forever.
+func (s *Service) PurgeExpiredTrash(ctx context.Context) (int64, error) {
+	if s.trashRetention <= 0 {
+		return 0, nil
+	}
+	purged, err := s.repo.PurgeTrashDB(ctx, time.Now().Add(-s.trashRetention))
+	if err != nil {
+		s.logger.WithFields(logrus.Fields{
+			"layer":       "service",
+			"function":    "PurgeExpiredTrash",
+			"subFunction": "PurgeTrashDB",
+		}).Errorf("error: %s", err.Error())
+		return 0, err
+	}
+	if purged != 0 {
+		s.logger.Infof("purged %d songs from trash", purged)
+	}
+	return purged, nil
+}
+
+// PurgeTrashEvery runs PurgeExpiredTrash right away and then once per
+// interval until ctx is done. It returns right away if the retention window
+// is zero.
+func (s *Service) PurgeTrashEvery(ctx context.Context, interval time.Duration) {
+	if s.trashRetention <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		_, _ = s.PurgeExpiredTrash(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package service
+
+import (
+	"fmt"
+	"github.com/mao360/musicLib/models"
+	"github.com/mao360/musicLib/pkg/apperrors"
+	"unicode/utf8"
+)
+
+const (
+	// maxNameLength is the length of the VARCHAR(255) columns: artist and
+	// song names, album titles and links.
+	maxNameLength = 255
+	// maxTextLength limits the lyrics, the column is unbounded TEXT.
+	maxTextLength = 100000
+)
+
+// allowedLinkSchemes are the schemes CheckLink accepts.
+var allowedLinkSchemes = map[string]struct{}{
+	"http":  {},
+	"https": {},
+}
+
+// validateSongField checks one models.Song field given by its JSON name.
+// It returns the problem or an empty string.
+func validateSongField(field, value string) string {
+	switch field {
+	case "group", "song":
+		if value == "" {
+			return "is required"
+		}
+		if utf8.RuneCountInString(value) > maxNameLength {
+			return fmt.Sprintf("must be at most %d characters", maxNameLength)
+		}
+	case "text":
+		if utf8.RuneCountInString(value) > maxTextLength {
+			return fmt.Sprintf("must be at most %d characters", maxTextLength)
+		}
+	case "releaseDate":
+		if !CheckDate(value) {
+			return invalidDate.Error() + ", use dd.mm.yyyy"
+		}
+	case "link":
+		if utf8.RuneCountInString(value) > maxNameLength {
+			return fmt.Sprintf("must be at most %d characters", maxNameLength)
+		}
+		if !CheckLink(value) {
+			return invalidLink.Error() + ", use an absolute http or https URL"
+		}
+	}
+	return ""
+}
+
+// validateNameLength checks that a value fits a VARCHAR(255) column, field is
+// its JSON name.
+func validateNameLength(field, value string) error {
+	if utf8.RuneCountInString(value) > maxNameLength {
+		return apperrors.Field(field, fmt.Sprintf("must be at most %d characters", maxNameLength))
+	}
+	return nil
+}
+
+// ValidateSong checks every field of a song that is created or replaced and
+// reports all the invalid ones in a single apperrors.Validation error.
+func ValidateSong(song models.Song) error {
+	return validateFields(songFields(song), false)
+}
+
+// ValidatePendingSong checks a song stored ahead of its details, only group
+// and song are required and the empty details are left to the enrichment.
+func ValidatePendingSong(song models.Song) error {
+	return validateFields(songFields(song), true)
+}
+
+type songField struct {
+	name, value string
+}
+
+func songFields(song models.Song) []songField {
+	return []songField{
+		{"group", song.Group},
+		{"song", song.Song},
+		{"text", song.Text},
+		{"releaseDate", song.ReleaseDate},
+		{"link", song.Link},
+	}
+}
+
+// validateFields runs validateSongField on every field, with skipEmpty the
+// empty fields other than group and song are not checked.
+func validateFields(fields []songField, skipEmpty bool) error {
+	invalid := make([]apperrors.FieldError, 0)
+	for _, field := range fields {
+		if skipEmpty && field.value == "" && field.name != "group" && field.name != "song" {
+			continue
+		}
+		if message := validateSongField(field.name, field.value); message != "" {
+			invalid = append(invalid, apperrors.FieldError{Field: field.name, Message: message})
+		}
+	}
+	if len(invalid) != 0 {
+		return apperrors.Invalid(invalid...)
+	}
+	return nil
+}
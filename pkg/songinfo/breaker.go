@@ -0,0 +1,76 @@
+package songinfo
+
+import (
+	"sync"
+	"time"
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	// breakerHalfOpen lets a single trial call through after the cooldown.
+	breakerHalfOpen
+)
+
+// breaker is a circuit breaker: threshold failed calls in a row open it and
+// the calls are refused for cooldown, then one trial call decides whether
+// it closes again. A zero threshold never opens it.
+type breaker struct {
+	mu        sync.Mutex
+	threshold int
+	cooldown  time.Duration
+	state     breakerState
+	failures  int
+	openedAt  time.Time
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow reports whether a call may go out.
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerClosed:
+		return true
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		return true
+	default:
+		return false
+	}
+}
+
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = breakerClosed
+	b.failures = 0
+}
+
+func (b *breaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.state == breakerHalfOpen || (b.threshold > 0 && b.failures >= b.threshold) {
+		b.state = breakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// abort ends a call that says nothing about the service, a trial call
+// given up by the caller leaves the next call to try again.
+func (b *breaker) abort() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerHalfOpen {
+		b.state = breakerOpen
+	}
+}
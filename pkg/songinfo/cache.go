@@ -0,0 +1,192 @@
+package songinfo
+
+import (
+	"context"
+	"errors"
+	"github.com/mao360/musicLib/models"
+	"github.com/mao360/musicLib/pkg/apperrors"
+	"github.com/sirupsen/logrus"
+	"strings"
+	"time"
+)
+
+type CacheConfig struct {
+	// Size is the number of entries kept in memory, zero turns the memory
+	// tier off.
+	Size int
+	// TTL is how long an answer is kept, zero turns caching off: entries
+	// already stored are not read either, rejections included.
+	TTL time.Duration
+	// NegativeTTL is how long a rejected song is remembered, zero turns
+	// negative caching off.
+	NegativeTTL time.Duration
+}
+
+// Store is the persistent tier of Cache, *postgres.DB is one.
+type Store interface {
+	GetSongInfoCacheDB(ctx context.Context, key string) (models.SongInfoCacheEntry, bool, error)
+	PutSongInfoCacheDB(ctx context.Context, entry models.SongInfoCacheEntry) error
+	DeleteSongInfoCacheDB(ctx context.Context, key string) error
+	ClearSongInfoCacheDB(ctx context.Context) error
+	PurgeSongInfoCacheDB(ctx context.Context) (int64, error)
+}
+
+type CacheInterface interface {
+	Invalidate(ctx context.Context, group, song string) error
+	Clear(ctx context.Context) error
+}
+
+// Cache keeps the answers of a provider by normalized group and song, in
+// memory and, with a Store, in the database. Songs the provider rejected are
+// cached too and rejected again without asking it. The persistent tier is
+// best effort, its errors are logged and the call goes on.
+type Cache struct {
+	config CacheConfig
+	memory *lru
+	store  Store
+	logger *logrus.Logger
+}
+
+// NewCache returns the cache, store is nil for memory only.
+func NewCache(config CacheConfig, store Store, logger *logrus.Logger) *Cache {
+	return &Cache{config, newLRU(config.Size), store, logger}
+}
+
+// CacheKey is the key of a song in the cache and in the file provider: group
+// and song lower cased with their spaces collapsed.
+func CacheKey(group, song string) string {
+	return normalize(group) + "\x1f" + normalize(song)
+}
+
+func normalize(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
+
+// Wrap returns provider answering from the cache.
+func (c *Cache) Wrap(provider EnrichmentProvider) EnrichmentProvider {
+	return &cachedProvider{provider, c}
+}
+
+func (c *Cache) get(ctx context.Context, key string) (models.SongInfoCacheEntry, bool) {
+	if entry, ok := c.memory.get(key, time.Now()); ok {
+		return entry, true
+	}
+	if c.store == nil {
+		return models.SongInfoCacheEntry{}, false
+	}
+	entry, ok, err := c.store.GetSongInfoCacheDB(ctx, key)
+	if err != nil {
+		c.logger.WithFields(logrus.Fields{
+			"layer":       "client",
+			"function":    "Cache.get",
+			"subFunction": "GetSongInfoCacheDB",
+		}).Errorf("error: %s", err.Error())
+		return models.SongInfoCacheEntry{}, false
+	}
+	if ok {
+		c.memory.put(entry)
+	}
+	return entry, ok
+}
+
+func (c *Cache) put(ctx context.Context, entry models.SongInfoCacheEntry) {
+	c.memory.put(entry)
+	if c.store == nil {
+		return
+	}
+	if err := c.store.PutSongInfoCacheDB(ctx, entry); err != nil {
+		c.logger.WithFields(logrus.Fields{
+			"layer":       "client",
+			"function":    "Cache.put",
+			"subFunction": "PutSongInfoCacheDB",
+		}).Errorf("error: %s", err.Error())
+	}
+}
+
+// Invalidate drops the entry of the song from both tiers.
+func (c *Cache) Invalidate(ctx context.Context, group, song string) error {
+	key := CacheKey(group, song)
+	c.logger.Debugf("invalidate key=%q", key)
+	c.memory.remove(key)
+	if c.store == nil {
+		return nil
+	}
+	return c.store.DeleteSongInfoCacheDB(ctx, key)
+}
+
+// Clear drops every entry from both tiers.
+func (c *Cache) Clear(ctx context.Context) error {
+	c.logger.Debugf("clear")
+	c.memory.clear()
+	if c.store == nil {
+		return nil
+	}
+	return c.store.ClearSongInfoCacheDB(ctx)
+}
+
+// PurgeExpired deletes the expired entries of the persistent tier, the
+// memory tier is bounded by its size.
+func (c *Cache) PurgeExpired(ctx context.Context) (int64, error) {
+	if c.store == nil {
+		return 0, nil
+	}
+	purged, err := c.store.PurgeSongInfoCacheDB(ctx)
+	if err != nil {
+		c.logger.WithFields(logrus.Fields{
+			"layer":       "client",
+			"function":    "Cache.PurgeExpired",
+			"subFunction": "PurgeSongInfoCacheDB",
+		}).Errorf("error: %s", err.Error())
+		return 0, err
+	}
+	if purged != 0 {
+		c.logger.Infof("purged %d expired song info cache entries", purged)
+	}
+	return purged, nil
+}
+
+// PurgeEvery runs PurgeExpired right away and then once per interval until
+// ctx is done. It returns right away without a persistent tier.
+func (c *Cache) PurgeEvery(ctx context.Context, interval time.Duration) {
+	if c.store == nil {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		_, _ = c.PurgeExpired(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+type cachedProvider struct {
+	EnrichmentProvider
+	cache *Cache
+}
+
+func (p *cachedProvider) GetSongInfo(ctx context.Context, group, song string) (models.Song, error) {
+	if p.cache.config.TTL <= 0 {
+		return p.EnrichmentProvider.GetSongInfo(ctx, group, song)
+	}
+	key := CacheKey(group, song)
+	if entry, ok := p.cache.get(ctx, key); ok {
+		p.cache.logger.Debugf("cache hit key=%q rejected=%t", key, entry.Rejected)
+		if entry.Rejected {
+			return models.Song{}, ErrRejected
+		}
+		return entry.Info, nil
+	}
+
+	info, err := p.EnrichmentProvider.GetSongInfo(ctx, group, song)
+	switch {
+	case err == nil:
+		p.cache.put(ctx, models.SongInfoCacheEntry{Key: key, Info: info, ExpiresAt: time.Now().Add(p.cache.config.TTL)})
+	case errors.Is(err, apperrors.ErrValidation) && p.cache.config.NegativeTTL > 0:
+		p.cache.put(ctx, models.SongInfoCacheEntry{Key: key, Rejected: true, ExpiresAt: time.Now().Add(p.cache.config.NegativeTTL)})
+	}
+	return info, err
+}
@@ -0,0 +1,195 @@
+// Package songinfo fetches the details of a song by its group and name: from
+// the external song info service, from a local metadata file or from a chain
+// of such providers.
+package songinfo
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mao360/musicLib/models"
+	"github.com/mao360/musicLib/pkg/apperrors"
+	"github.com/sirupsen/logrus"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// maxResponseSize limits the body read from the service.
+const maxResponseSize = 1 << 20
+
+var (
+	ErrCircuitOpen = apperrors.New(apperrors.Unavailable, "song info service is unavailable, try again later")
+	ErrRejected    = apperrors.New(apperrors.Validation, "song info service rejected the song")
+)
+
+type Config struct {
+	// Domain is the base URL of the service, /info is requested on it.
+	Domain string
+	// Timeout bounds a single attempt, response body included.
+	Timeout time.Duration
+	// Retries is the number of attempts made after the first failed one.
+	Retries int
+	// Backoff is the base of the jittered exponential pause between
+	// attempts.
+	Backoff time.Duration
+	// BreakerThreshold failed calls in a row stop the calls for
+	// BreakerCooldown, zero turns the circuit breaker off.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+}
+
+type ClientInterface interface {
+	GetSongInfo(ctx context.Context, group, song string) (models.Song, error)
+}
+
+type Client struct {
+	config  Config
+	http    *http.Client
+	breaker *breaker
+	logger  *logrus.Logger
+}
+
+func NewClient(config Config, logger *logrus.Logger) *Client {
+	return &Client{
+		config:  config,
+		http:    &http.Client{Timeout: config.Timeout},
+		breaker: newBreaker(config.BreakerThreshold, config.BreakerCooldown),
+		logger:  logger,
+	}
+}
+
+func (c *Client) Name() string {
+	return ProviderAPI
+}
+
+// GetSongInfo asks the service for the song. Timeouts, network failures and
+// 5xx or 429 answers are retried. The errors are *apperrors.Error of kind
+// Validation when the service rejects the song, Timeout when it does not
+// answer in time, Unavailable while the circuit is open and Upstream
+// otherwise; an error of ctx is returned as is.
+func (c *Client) GetSongInfo(ctx context.Context, group, song string) (models.Song, error) {
+	c.logger.Debugf("group=%s song=%s", group, song)
+	if !c.breaker.allow() {
+		c.logger.WithFields(logrus.Fields{
+			"layer":    "client",
+			"function": "GetSongInfo",
+		}).Errorf("error: %s", ErrCircuitOpen.Error())
+		return models.Song{}, ErrCircuitOpen
+	}
+
+	var info models.Song
+	var err error
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		info, retry, err = c.get(ctx, group, song)
+		if err == nil || !retry || attempt == c.config.Retries {
+			break
+		}
+		c.logger.WithFields(logrus.Fields{
+			"layer":       "client",
+			"function":    "GetSongInfo",
+			"subFunction": "get()",
+			"attempt":     attempt + 1,
+		}).Errorf("error: %s", err.Error())
+		if sleepErr := sleep(ctx, backoff(c.config.Backoff, attempt)); sleepErr != nil {
+			err = sleepErr
+			break
+		}
+	}
+
+	switch {
+	case ctx.Err() != nil:
+		// The caller gave up, that says nothing about the service.
+		c.breaker.abort()
+	case err == nil || errors.Is(err, apperrors.ErrValidation):
+		c.breaker.success()
+	default:
+		c.breaker.failure()
+	}
+	if err != nil {
+		c.logger.WithFields(logrus.Fields{
+			"layer":       "client",
+			"function":    "GetSongInfo",
+			"subFunction": "get()",
+		}).Errorf("error: %s", err.Error())
+		return models.Song{}, err
+	}
+	return info, nil
+}
+
+// get makes a single attempt and tells whether a failed one is worth
+// retrying.
+func (c *Client) get(ctx context.Context, group, song string) (models.Song, bool, error) {
+	query := url.Values{}
+	query.Set("group", group)
+	query.Set("song", song)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.config.Domain+"/info?"+query.Encode(), nil)
+	if err != nil {
+		return models.Song{}, false, err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return models.Song{}, true, transportError(ctx, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+	case resp.StatusCode == http.StatusBadRequest:
+		return models.Song{}, false, ErrRejected
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= http.StatusInternalServerError:
+		return models.Song{}, true, statusError(resp.StatusCode)
+	default:
+		return models.Song{}, false, statusError(resp.StatusCode)
+	}
+	info := models.Song{}
+	if err = json.NewDecoder(io.LimitReader(resp.Body, maxResponseSize)).Decode(&info); err != nil {
+		var netErr net.Error
+		if ctx.Err() != nil || errors.As(err, &netErr) {
+			return models.Song{}, true, transportError(ctx, err)
+		}
+		return models.Song{}, false, apperrors.Wrap(apperrors.Upstream, "song info service sent a malformed response", err)
+	}
+	return info, false, nil
+}
+
+func statusError(code int) error {
+	return apperrors.New(apperrors.Upstream, fmt.Sprintf("song info service answered %d", code))
+}
+
+// transportError classifies an error of the connection to the service.
+func transportError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return apperrors.Wrap(apperrors.Timeout, "song info service timed out", err)
+	}
+	return apperrors.Wrap(apperrors.Upstream, "song info service is unreachable", err)
+}
+
+// backoff is the pause before the retry following attempt: a random
+// duration below base doubled attempt times.
+func backoff(base time.Duration, attempt int) time.Duration {
+	if base <= 0 {
+		return 0
+	}
+	return rand.N(base << attempt)
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,93 @@
+package songinfo
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/mao360/musicLib/models"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// File is a provider of the song details listed in a local JSON or CSV file.
+// The JSON file is an array of songs in the API format, the CSV file has a
+// header naming the same fields: group, song, text, releaseDate and link.
+// Songs are matched by group and name regardless of case.
+type File struct {
+	songs map[string]models.Song
+}
+
+// NewFile loads the file at path, its format is told by the extension.
+func NewFile(path string) (*File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var songs []models.Song
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.NewDecoder(f).Decode(&songs)
+	case ".csv":
+		songs, err = readCSVSongs(f)
+	default:
+		err = fmt.Errorf("unsupported metadata file %s, use .json or .csv", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	provider := &File{songs: make(map[string]models.Song, len(songs))}
+	for _, song := range songs {
+		provider.songs[CacheKey(song.Group, song.Song)] = song
+	}
+	return provider, nil
+}
+
+func readCSVSongs(r io.Reader) ([]models.Song, error) {
+	reader := csv.NewReader(r)
+	header, err := reader.Read()
+	if err != nil {
+		return nil, err
+	}
+	songs := make([]models.Song, 0)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return songs, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		song := models.Song{}
+		for i, column := range header {
+			if i >= len(record) {
+				break
+			}
+			switch strings.TrimSpace(column) {
+			case "group":
+				song.Group = record[i]
+			case "song":
+				song.Song = record[i]
+			case "text":
+				song.Text = record[i]
+			case "releaseDate":
+				song.ReleaseDate = record[i]
+			case "link":
+				song.Link = record[i]
+			}
+		}
+		songs = append(songs, song)
+	}
+}
+
+func (p *File) Name() string {
+	return ProviderFile
+}
+
+func (p *File) GetSongInfo(ctx context.Context, group, song string) (models.Song, error) {
+	return p.songs[CacheKey(group, song)], nil
+}
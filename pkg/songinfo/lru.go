@@ -0,0 +1,73 @@
+package songinfo
+
+import (
+	"container/list"
+	"github.com/mao360/musicLib/models"
+	"sync"
+	"time"
+)
+
+// lru is the in-memory tier of Cache: at most capacity entries, the least
+// recently used one goes first. A zero capacity keeps nothing.
+type lru struct {
+	mu       sync.Mutex
+	capacity int
+	items    map[string]*list.Element
+	order    *list.List
+}
+
+func newLRU(capacity int) *lru {
+	return &lru{capacity: capacity, items: make(map[string]*list.Element), order: list.New()}
+}
+
+func (l *lru) get(key string, now time.Time) (models.SongInfoCacheEntry, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	element, ok := l.items[key]
+	if !ok {
+		return models.SongInfoCacheEntry{}, false
+	}
+	entry := element.Value.(models.SongInfoCacheEntry)
+	if !now.Before(entry.ExpiresAt) {
+		l.order.Remove(element)
+		delete(l.items, key)
+		return models.SongInfoCacheEntry{}, false
+	}
+	l.order.MoveToFront(element)
+	return entry, true
+}
+
+func (l *lru) put(entry models.SongInfoCacheEntry) {
+	if l.capacity <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if element, ok := l.items[entry.Key]; ok {
+		element.Value = entry
+		l.order.MoveToFront(element)
+		return
+	}
+	l.items[entry.Key] = l.order.PushFront(entry)
+	if l.order.Len() > l.capacity {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.items, oldest.Value.(models.SongInfoCacheEntry).Key)
+	}
+}
+
+func (l *lru) remove(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if element, ok := l.items[key]; ok {
+		l.order.Remove(element)
+		delete(l.items, key)
+	}
+}
+
+func (l *lru) clear() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.items = make(map[string]*list.Element)
+	l.order.Init()
+}
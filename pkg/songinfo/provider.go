@@ -0,0 +1,101 @@
+package songinfo
+
+import (
+	"context"
+	"github.com/mao360/musicLib/models"
+	"github.com/mao360/musicLib/pkg/apperrors"
+	"github.com/sirupsen/logrus"
+)
+
+// Names of the providers in the ENRICHMENT_PROVIDERS setting.
+const (
+	ProviderAPI  = "api"
+	ProviderFile = "file"
+	ProviderNoop = "noop"
+)
+
+// EnrichmentProvider is a source of song details. A provider that knows
+// nothing of the song answers an empty song and no error.
+type EnrichmentProvider interface {
+	Name() string
+	GetSongInfo(ctx context.Context, group, song string) (models.Song, error)
+}
+
+// Chain asks its providers in order and merges their answers by precedence:
+// each detail comes from the first provider that has it. Later providers are
+// only asked while a detail is still missing.
+type Chain struct {
+	providers []EnrichmentProvider
+	logger    *logrus.Logger
+}
+
+func NewChain(logger *logrus.Logger, providers ...EnrichmentProvider) *Chain {
+	return &Chain{providers, logger}
+}
+
+// GetSongInfo returns the merged details of the song. A failing provider is
+// skipped, the error of the first one is returned only if none answered. A
+// rejection (a Validation error) is returned at once, later providers such
+// as Noop answering would hide it.
+func (c *Chain) GetSongInfo(ctx context.Context, group, song string) (models.Song, error) {
+	merged := models.Song{Group: group, Song: song}
+	var firstErr error
+	answered := false
+	for _, provider := range c.providers {
+		if merged.Text != "" && merged.ReleaseDate != "" && merged.Link != "" {
+			break
+		}
+		info, err := provider.GetSongInfo(ctx, group, song)
+		if err != nil {
+			c.logger.WithFields(logrus.Fields{
+				"layer":       "client",
+				"function":    "Chain.GetSongInfo",
+				"subFunction": provider.Name(),
+			}).Errorf("error: %s", err.Error())
+			if apperrors.KindOf(err) == apperrors.Validation {
+				return models.Song{}, err
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+			if ctx.Err() != nil {
+				break
+			}
+			continue
+		}
+		answered = true
+		merged = Merge(merged, info)
+	}
+	if !answered && firstErr != nil {
+		return models.Song{}, firstErr
+	}
+	c.logger.Debugf("group=%s song=%s release=%s link=%s", group, song, merged.ReleaseDate, merged.Link)
+	return merged, nil
+}
+
+// Merge fills the empty details of song in from info, the details already
+// set take precedence.
+func Merge(song, info models.Song) models.Song {
+	if song.Text == "" {
+		song.Text = info.Text
+	}
+	if song.ReleaseDate == "" {
+		song.ReleaseDate = info.ReleaseDate
+	}
+	if song.Link == "" {
+		song.Link = info.Link
+	}
+	return song
+}
+
+// Noop is a provider without any details, with it alone songs are stored
+// as they are sent.
+type Noop struct{}
+
+func (Noop) Name() string {
+	return ProviderNoop
+}
+
+func (Noop) GetSongInfo(ctx context.Context, group, song string) (models.Song, error) {
+	return models.Song{}, nil
+}